@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+)
+
+// APIKeyPrefix starts every api key so they can be told apart from the
+// access tokens and found by secret scanners.
+const APIKeyPrefix = "acd_"
+
+// Keys are not touched more often than this, to avoid a write per request
+const apiKeyTouchInterval = time.Minute
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// NewAPIKey returns the key for the user, its public prefix and the hash to
+// store, keys look like acd_<prefix>_<secret>.
+func NewAPIKey() (string, string, string, error) {
+	prefix, err := RandomToken(6)
+	if err != nil {
+		return "", "", "", err
+	}
+	// The prefix is split on the underscore
+	prefix = strings.ReplaceAll(prefix, "_", "-")
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	key := APIKeyPrefix + prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// ParseAPIKey returns the stored key when the key is valid and active.
+func ParseAPIKey(ctx context.Context, key string) (*models.APIKey, error) {
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if !IsAPIKey(key) || len(parts) != 2 {
+		return nil, ErrInvalidAPIKey
+	}
+	stored, err := repository.GetAPIKeyByPrefix(ctx, parts[0])
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(HashToken(key))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if !stored.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) > apiKeyTouchInterval {
+		repository.TouchAPIKey(ctx, stored.Id, now)
+	}
+	return stored, nil
+}
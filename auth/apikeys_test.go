@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, hash, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAPIKey(key) || !strings.HasPrefix(key, APIKeyPrefix+prefix+"_") {
+		t.Fatalf("the key %q does not start with %q", key, APIKeyPrefix+prefix+"_")
+	}
+	if strings.Contains(prefix, "_") {
+		t.Fatalf("the prefix %q has an underscore", prefix)
+	}
+	if hash != HashToken(key) || strings.Contains(hash, key) {
+		t.Fatal("the hash is not the hash of the key")
+	}
+	other, _, _, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Fatal("two keys are the same")
+	}
+	if IsAPIKey("eyJhbGciOiJSUzI1NiJ9.e30.sig") {
+		t.Fatal("an access token is taken for an api key")
+	}
+}
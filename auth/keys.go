@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dg/acordia/jwks"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+	// Servers reload the key directory this often to start signing with a
+	// rotated key, verification also reloads on an unknown kid
+	KeyReloadInterval = time.Minute
+	// A replaced key keeps verifying the tokens it signed until they expire
+	KeyRetention = AccessTokenTTL + KeyReloadInterval
+)
+
+const (
+	keyFileExtension = ".pem"
+	keyCreatedHeader = "Created"
+	// Unknown kids do not reload the keys more often than this
+	keyMissReload = 10 * time.Second
+)
+
+var ErrNoSigningKey = errors.New("no signing key")
+
+// SigningKey is a private key of the key directory, the newest one signs the
+// tokens and the others only verify them.
+type SigningKey struct {
+	Id        string
+	Algorithm string
+	CreatedAt time.Time
+	private   crypto.Signer
+}
+
+func (key *SigningKey) method() jwt.SigningMethod {
+	if key.Algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// KeySet signs and verifies the access tokens. The keys are read from a
+// directory shared by every server, see cmd/jwtkeys. Without a directory the
+// legacy secret signs and verifies HS256 tokens, with one it only verifies
+// them for AccessTokenTTL so the tokens signed before the switch expire.
+type KeySet struct {
+	dir    string
+	secret []byte
+	// HS256 tokens are refused after this, zero when there is no directory
+	secretUntil time.Time
+	mutex       *sync.RWMutex
+	keys        map[string]*SigningKey
+	active      *SigningKey
+	loadedAt    time.Time
+}
+
+func NewKeySet(dir string, secret string) (*KeySet, error) {
+	if dir == "" && secret == "" {
+		return nil, errors.New("a jwt key directory or secret is required")
+	}
+	set := &KeySet{
+		dir:    dir,
+		secret: []byte(secret),
+		mutex:  &sync.RWMutex{},
+		keys:   make(map[string]*SigningKey),
+	}
+	if dir == "" {
+		return set, nil
+	}
+	if secret != "" {
+		set.secretUntil = time.Now().Add(AccessTokenTTL)
+		log.Println("Accepting tokens signed with the jwt secret until", set.secretUntil.Format(time.RFC3339), "remove it once every server uses the key directory")
+	}
+	if err := set.Reload(); err != nil {
+		return nil, err
+	}
+	if set.active == nil {
+		return nil, fmt.Errorf("no signing keys in %s, create one with go run ./cmd/jwtkeys -dir %s", dir, dir)
+	}
+	return set, nil
+}
+
+// Reload reads the key directory again, a failed read keeps the loaded keys.
+func (set *KeySet) Reload() error {
+	if set.dir == "" {
+		return nil
+	}
+	keys, err := ReadSigningKeys(set.dir)
+	if err != nil {
+		return err
+	}
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.loadedAt = time.Now()
+	if len(keys) == 0 {
+		return nil
+	}
+	set.keys = make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		set.keys[key.Id] = key
+	}
+	set.active = keys[len(keys)-1]
+	return nil
+}
+
+// Run reloads the keys until the program exits.
+func (set *KeySet) Run() {
+	if set.dir == "" {
+		return
+	}
+	for range time.Tick(KeyReloadInterval) {
+		if err := set.Reload(); err != nil {
+			log.Println("Error reloading the jwt keys:", err)
+		}
+	}
+}
+
+func (set *KeySet) Sign(claims jwt.Claims) (string, error) {
+	set.mutex.RLock()
+	key := set.active
+	set.mutex.RUnlock()
+	if key == nil {
+		if len(set.secret) == 0 {
+			return "", ErrNoSigningKey
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(set.secret)
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.Id
+	return token.SignedString(key.private)
+}
+
+// Parse checks the signature with the key named by the kid of the token.
+func (set *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if len(set.secret) == 0 || (!set.secretUntil.IsZero() && time.Now().After(set.secretUntil)) {
+				return nil, ErrInvalidToken
+			}
+			return set.secret, nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		key := set.key(kid)
+		if key == nil || key.method().Alg() != token.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return key.private.Public(), nil
+	})
+}
+
+// key reloads the directory when the kid is unknown, another server may have
+// started signing with a new key.
+func (set *KeySet) key(kid string) *SigningKey {
+	set.mutex.RLock()
+	key, ok := set.keys[kid]
+	stale := time.Since(set.loadedAt) > keyMissReload
+	set.mutex.RUnlock()
+	if ok || !stale || set.dir == "" {
+		return key
+	}
+	if err := set.Reload(); err != nil {
+		return nil
+	}
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+	return set.keys[kid]
+}
+
+// JWKS returns the public keys, the legacy secret is never published.
+func (set *KeySet) JWKS() (jwks.Set, error) {
+	set.mutex.RLock()
+	defer set.mutex.RUnlock()
+	document := jwks.Set{Keys: []jwks.Key{}}
+	for _, key := range set.keys {
+		public, err := jwks.FromPublicKey(key.Id, key.Algorithm, key.private.Public())
+		if err != nil {
+			return jwks.Set{}, err
+		}
+		document.Keys = append(document.Keys, public)
+	}
+	sort.Slice(document.Keys, func(i, j int) bool {
+		return document.Keys[i].Kid < document.Keys[j].Kid
+	})
+	return document, nil
+}
+
+// NewSigningKey generates a key of the algorithm, RS256 or EdDSA.
+func NewSigningKey(algorithm string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &SigningKey{
+		Id:        hex.EncodeToString(id),
+		Algorithm: algorithm,
+		CreatedAt: time.Now().UTC(),
+		private:   private,
+	}, nil
+}
+
+// WriteSigningKey stores the key as <kid>.pem in the directory.
+func WriteSigningKey(dir string, key *SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{keyCreatedHeader: key.CreatedAt.Format(time.RFC3339)},
+		Bytes:   der,
+	})
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// Servers reading the directory never see a half written key
+	path := filepath.Join(dir, key.Id+keyFileExtension)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// ReadSigningKeys returns the keys of the directory, oldest first.
+func ReadSigningKeys(dir string) ([]*SigningKey, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := []*SigningKey{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), keyFileExtension) {
+			continue
+		}
+		key, err := readSigningKey(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].Id < keys[j].Id
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func readSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("not a PKCS8 private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{Id: strings.TrimSuffix(filepath.Base(path), keyFileExtension)}
+	switch parsed := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.private = AlgorithmRS256, parsed
+	case ed25519.PrivateKey:
+		key.Algorithm, key.private = AlgorithmEdDSA, parsed
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+	// Keys made by other tools fall back to the time of the file
+	if created, err := time.Parse(time.RFC3339, block.Headers[keyCreatedHeader]); err == nil {
+		key.CreatedAt = created
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		key.CreatedAt = info.ModTime().UTC()
+	}
+	return key, nil
+}
+
+func RemoveSigningKey(dir string, key *SigningKey) error {
+	return os.Remove(filepath.Join(dir, key.Id+keyFileExtension))
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// claims expire after the test.
+func claims() jwt.Claims {
+	return &jwt.StandardClaims{Subject: "alice", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+}
+
+// writeKey adds a key created at the time to the directory.
+func writeKey(t *testing.T, dir string, algorithm string, createdAt time.Time) *SigningKey {
+	t.Helper()
+	key, err := NewSigningKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.CreatedAt = createdAt.UTC().Truncate(time.Second)
+	if err := WriteSigningKey(dir, key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSigningKeysFile(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	newer := writeKey(t, dir, AlgorithmEdDSA, now)
+	older := writeKey(t, dir, AlgorithmRS256, now.Add(-time.Hour))
+	if _, err := NewSigningKey("HS256"); err == nil {
+		t.Fatal("created a key of an unsupported algorithm")
+	}
+
+	keys, err := ReadSigningKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Id != older.Id || keys[1].Id != newer.Id {
+		t.Fatalf("read %d keys, want the two keys oldest first", len(keys))
+	}
+	if keys[0].Algorithm != AlgorithmRS256 || keys[1].Algorithm != AlgorithmEdDSA || !keys[1].CreatedAt.Equal(newer.CreatedAt) {
+		t.Fatalf("read the keys %+v and %+v", keys[0], keys[1])
+	}
+
+	if err := RemoveSigningKey(dir, older); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := ReadSigningKeys(dir); err != nil || len(keys) != 1 {
+		t.Fatalf("read %d keys after the removal, %v", len(keys), err)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewKeySet(dir, ""); err == nil {
+		t.Fatal("created a key set without keys")
+	}
+	first := writeKey(t, dir, AlgorithmRS256, time.Now().Add(-time.Hour))
+	set, err := NewKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := set.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := set.Parse(signed, &jwt.StandardClaims{})
+	if err != nil || token.Header["kid"] != first.Id {
+		t.Fatalf("parsed the token with the kid %v, %v, want %s", token.Header["kid"], err, first.Id)
+	}
+
+	// The new key signs after the reload, the old one still verifies
+	second := writeKey(t, dir, AlgorithmEdDSA, time.Now())
+	if err := set.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := set.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := set.Parse(rotated, &jwt.StandardClaims{}); err != nil || token.Header["kid"] != second.Id {
+		t.Fatalf("parsed the token with the kid %v, %v, want %s", token.Header["kid"], err, second.Id)
+	}
+	if _, err := set.Parse(signed, &jwt.StandardClaims{}); err != nil {
+		t.Fatal("the token of the old key is not verified:", err)
+	}
+
+	document, err := set.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Keys) != 2 {
+		t.Fatalf("published %d keys, want 2", len(document.Keys))
+	}
+	for _, key := range document.Keys {
+		if key.Kid == second.Id && (key.Kty != "OKP" || key.Alg != AlgorithmEdDSA) {
+			t.Fatalf("published the key %+v", key)
+		}
+		if _, err := key.PublicKey(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKeySetSecret(t *testing.T) {
+	secretOnly, err := NewKeySet("", "test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := secretOnly.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secretOnly.Parse(legacy, &jwt.StandardClaims{}); err != nil {
+		t.Fatal(err)
+	}
+	// The secret is never published
+	if document, err := secretOnly.JWKS(); err != nil || len(document.Keys) != 0 {
+		t.Fatalf("published %d keys, %v", len(document.Keys), err)
+	}
+
+	// With a key directory the secret only verifies the tokens it signed
+	dir := t.TempDir()
+	writeKey(t, dir, AlgorithmRS256, time.Now())
+	set, err := NewKeySet(dir, "test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.Parse(legacy, &jwt.StandardClaims{}); err != nil {
+		t.Fatal("the token of the secret is not verified:", err)
+	}
+	set.secretUntil = time.Now().Add(-time.Second)
+	if _, err := set.Parse(legacy, &jwt.StandardClaims{}); err == nil {
+		t.Fatal("the token of the secret is verified after the switch")
+	}
+	other, err := NewKeySet("", "another-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Parse(legacy, &jwt.StandardClaims{}); err == nil {
+		t.Fatal("the token is verified with another secret")
+	}
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/dg/acordia/models"
+)
+
+// Login throttling, after the free failures every new failure doubles the
+// wait before the next attempt up to the maximum lockout.
+const (
+	AccountFreeFailures = 5
+	// Addresses are shared by many users behind the same network
+	AddressFreeFailures = 20
+	LoginBackoffBase    = time.Second
+	MaxLoginLockout     = 15 * time.Minute
+	// Failures are forgotten after this time without new ones
+	LoginFailureWindow = time.Hour
+)
+
+// LoginRetryAfter returns how long the key has to wait before trying to log
+// in again, zero when it can try now.
+func LoginRetryAfter(attempts *models.LoginAttempts, freeFailures int, now time.Time) time.Duration {
+	extra := attempts.Failures - freeFailures
+	if extra < 0 {
+		return 0
+	}
+	lockout := MaxLoginLockout
+	// Past 20 doublings the wait is over the maximum anyway
+	if extra < 20 {
+		lockout = LoginBackoffBase << extra
+		if lockout > MaxLoginLockout {
+			lockout = MaxLoginLockout
+		}
+	}
+	wait := attempts.LastFailure.Add(lockout).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dg/acordia/models"
+)
+
+func TestLoginRetryAfter(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		failures int
+		since    time.Duration
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: AccountFreeFailures - 1, want: 0},
+		// Every failure past the free ones doubles the wait
+		{failures: AccountFreeFailures, want: LoginBackoffBase},
+		{failures: AccountFreeFailures + 3, want: 8 * LoginBackoffBase},
+		{failures: AccountFreeFailures + 3, since: 3 * time.Second, want: 5 * LoginBackoffBase},
+		{failures: AccountFreeFailures + 3, since: time.Minute, want: 0},
+		{failures: AccountFreeFailures + 12, want: MaxLoginLockout},
+		{failures: AccountFreeFailures + 100, since: time.Minute, want: MaxLoginLockout - time.Minute},
+	}
+	for _, test := range tests {
+		attempts := &models.LoginAttempts{Failures: test.failures, LastFailure: now.Add(-test.since)}
+		if got := LoginRetryAfter(attempts, AccountFreeFailures, now); got != test.want {
+			t.Errorf("%d failures %s ago wait %s, want %s", test.failures, test.since, got, test.want)
+		}
+	}
+}
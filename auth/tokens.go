@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AccessTokenTTL   = 15 * time.Minute
+	RefreshTokenTTL  = 30 * 24 * time.Hour
+	PasswordResetTTL = time.Hour
+	VerificationTTL  = 48 * time.Hour
+)
+
+// Sessions are not touched more often than this, to avoid a write per request
+const sessionTouchInterval = time.Minute
+
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrRevokedSession = errors.New("session revoked or expired")
+)
+
+func NewAccessToken(keys *KeySet, userId primitive.ObjectID, sessionId primitive.ObjectID) (string, error) {
+	claim := models.AppClaims{
+		UserId:    userId,
+		SessionId: sessionId,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
+		},
+	}
+	return keys.Sign(claim)
+}
+
+// ParseAccessToken checks the signature of the token and that its session was
+// not revoked.
+func ParseAccessToken(ctx context.Context, keys *KeySet, tokenString string) (*models.AppClaims, error) {
+	token, err := keys.Parse(tokenString, &models.AppClaims{})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*models.AppClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	session, err := repository.GetSessionById(ctx, claims.SessionId.Hex())
+	if err != nil {
+		return nil, ErrRevokedSession
+	}
+	now := time.Now()
+	if session.UserId != claims.UserId || !session.Active(now) {
+		return nil, ErrRevokedSession
+	}
+	if now.Sub(session.LastActiveAt) > sessionTouchInterval {
+		repository.TouchSession(ctx, session.Id, now)
+	}
+	return claims, nil
+}
+
+// NewRefreshToken returns the token for the client and the hash to store,
+// the token starts with the session id so it can be found without scanning.
+func NewRefreshToken(sessionId primitive.ObjectID) (string, string, error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := sessionId.Hex() + "." + secret
+	return token, HashToken(token), nil
+}
+
+func ParseRefreshToken(token string) (string, string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || !primitive.IsValidObjectID(parts[0]) {
+		return "", "", ErrInvalidToken
+	}
+	return parts[0], HashToken(token), nil
+}
+
+// NewUserToken returns the token to mail to the user and the record to store
+// for it.
+func NewUserToken(userId primitive.ObjectID, purpose string, ttl time.Duration) (string, *models.UserToken, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	return token, &models.UserToken{
+		Id:        primitive.NewObjectID(),
+		UserId:    userId,
+		Purpose:   purpose,
+		Hash:      HashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, nil
+}
+
+func RandomToken(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// HashToken is used for every secret stored by the server, the tokens are
+// random so a plain sha256 is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
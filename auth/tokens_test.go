@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRefreshToken(t *testing.T) {
+	sessionId := primitive.NewObjectID()
+	token, hash, err := NewRefreshToken(sessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, parsedHash, err := ParseRefreshToken(token)
+	if err != nil || id != sessionId.Hex() || parsedHash != hash {
+		t.Fatalf("ParseRefreshToken(%q) = %q, %q, %v", token, id, parsedHash, err)
+	}
+	other, _, err := NewRefreshToken(sessionId)
+	if err != nil || other == token {
+		t.Fatal("two refresh tokens of the session are the same")
+	}
+	for _, token := range []string{"", "no-dot", "not-an-id.secret", sessionId.Hex()} {
+		if _, _, err := ParseRefreshToken(token); err != ErrInvalidToken {
+			t.Errorf("ParseRefreshToken(%q) = %v, want ErrInvalidToken", token, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters, the ones every authenticator app supports.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// Codes of the steps around the current one are accepted to allow for
+	// clock drift
+	totpSkew = 1
+
+	TwoFactorIssuer    = "Acordia"
+	LoginChallengeTTL  = 5 * time.Minute
+	RecoveryCodesCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func NewTOTPSecret() (string, error) {
+	data := make([]byte, 20)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(data), nil
+}
+
+// TOTPProvisioningURI is the uri shown as a QR code to the authenticator app.
+func TOTPProvisioningURI(secret string, account string) string {
+	label := url.PathEscape(TwoFactorIssuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", TwoFactorIssuer)
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// ValidateTOTP returns the time step the code belongs to, callers store it to
+// reject the same code being used twice.
+func ValidateTOTP(secret string, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// NewRecoveryCodes returns the codes for the user and the hashes to store.
+func NewRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodesCount)
+	hashes := make([]string, RecoveryCodesCount)
+	for i := range codes {
+		data := make([]byte, 5)
+		if _, err := rand.Read(data); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(data))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode ignores the case and separators the user may type.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(code)
+}
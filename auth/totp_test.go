@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// The SHA1 vectors of RFC 6238, with the last six digits
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		if got := totpCode(key, unix/totpPeriod); got != want {
+			t.Errorf("the code at %d is %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	current := now.Unix() / totpPeriod
+
+	// Codes of the steps around the current one are accepted
+	for _, step := range []int64{current - 1, current, current + 1} {
+		if got, ok := ValidateTOTP(strings.ToLower(secret), totpCode(key, step), now); !ok || got != step {
+			t.Errorf("the code of the step %d validated as %d, %v", step-current, got, ok)
+		}
+	}
+	for _, code := range []string{totpCode(key, current-2), totpCode(key, current+2), "", "12345", "1234567"} {
+		if _, ok := ValidateTOTP(secret, code, now); ok {
+			t.Errorf("the code %q is valid", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", totpCode(key, current), now); ok {
+		t.Error("a code is valid for a broken secret")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodesCount || len(hashes) != RecoveryCodesCount {
+		t.Fatalf("got %d codes and %d hashes", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if seen[code] {
+			t.Fatalf("the code %s is repeated", code)
+		}
+		seen[code] = true
+		// The case and separators the user types do not matter
+		typed := strings.ToUpper(strings.Replace(code, "-", " ", 1))
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Errorf("%q does not match the hash of %q", typed, code)
+		}
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("SECRET", "alice@example.com")
+	want := "otpauth://totp/Acordia:alice@example.com?digits=6&issuer=Acordia&period=30&secret=SECRET"
+	if uri != want {
+		t.Fatalf("got %s, want %s", uri, want)
+	}
+}
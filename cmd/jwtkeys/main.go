@@ -0,0 +1,58 @@
+// Command jwtkeys rotates the keys that sign the access tokens. It adds a new
+// key to the directory, which the servers start signing with within a
+// minute, and removes the keys replaced long enough ago that no valid token
+// signed by them is left:
+//
+//	go run ./cmd/jwtkeys -dir keys -alg EdDSA
+//	JWT_KEYS_DIR=keys
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dg/acordia/auth"
+)
+
+func main() {
+	dir := flag.String("dir", "keys", "directory of the signing keys")
+	alg := flag.String("alg", auth.AlgorithmEdDSA, "algorithm of the new key, RS256 or EdDSA")
+	retain := flag.Duration("retain", auth.KeyRetention, "how long a replaced key keeps verifying tokens")
+	list := flag.Bool("list", false, "only list the keys")
+	flag.Parse()
+
+	if !*list {
+		key, err := auth.NewSigningKey(*alg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := auth.WriteSigningKey(*dir, key); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Added signing key", key.Id)
+	}
+
+	keys, err := auth.ReadSigningKeys(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	now := time.Now()
+	for i, key := range keys {
+		status := "signing"
+		if i < len(keys)-1 {
+			// A key is replaced when the next one is created
+			replacedAt := keys[i+1].CreatedAt
+			if !*list && now.Sub(replacedAt) > *retain {
+				if err := auth.RemoveSigningKey(*dir, key); err != nil {
+					log.Fatal(err)
+				}
+				log.Println("Removed signing key", key.Id)
+				continue
+			}
+			status = "verifying until " + replacedAt.Add(*retain).Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", key.Id, key.Algorithm, key.CreatedAt.Format(time.RFC3339), status)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/dg/acordia/database"
+	"github.com/joho/godotenv"
+)
+
+// One-shot migration that moves the messages embedded in the channels to
+// their own collection.
+func main() {
+	err := godotenv.Load(".env")
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+
+	repo, err := database.NewMongoRepo(os.Getenv("DB_URI"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer repo.Close()
+
+	moved, err := repo.MigrateEmbeddedMessages(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Messages migrated:", moved)
+}
@@ -0,0 +1,33 @@
+// Command mockoidc serves a provider that approves every login, to try the
+// single sign on locally:
+//
+//	go run ./cmd/mockoidc -addr localhost:9998
+//	OIDC_ISSUER=http://localhost:9998 OIDC_CLIENT_ID=acordia OIDC_REDIRECT_URL=http://localhost:5050/oidc/callback
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/dg/acordia/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9998", "address to listen on")
+	email := flag.String("email", "sso@example.com", "email of the user that logs in")
+	name := flag.String("name", "SSO User", "name of the user that logs in")
+	flag.Parse()
+
+	provider, err := oidctest.NewProvider("http://"+*addr, oidctest.User{
+		Subject:       "sub-" + *email,
+		Email:         *email,
+		EmailVerified: true,
+		Name:          *name,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Mock OpenID Connect provider on", provider.Issuer)
+	log.Fatal(http.ListenAndServe(*addr, provider.Handler()))
+}
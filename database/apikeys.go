@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (repo *MongoRepo) ListBots(ctx context.Context, ownerId primitive.ObjectID) ([]models.Profile, error) {
+	collection := repo.client.Database("Acordia").Collection("users")
+	cursor, err := collection.Find(ctx, bson.M{"bot": true, "owner_id": ownerId})
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return nil, err
+	}
+	profiles := []models.Profile{}
+	for _, user := range users {
+		profiles = append(profiles, models.Profile{
+			Id:        user.Id,
+			Name:      user.Name,
+			Email:     user.Email,
+			Image:     user.Image,
+			DesertRef: user.DesertRef,
+			Bot:       user.Bot,
+			OwnerId:   user.OwnerId,
+		})
+	}
+	return profiles, nil
+}
+
+func (repo *MongoRepo) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	collection := repo.client.Database("Acordia").Collection("api_keys")
+	_, err := collection.InsertOne(ctx, key)
+	return err
+}
+
+func (repo *MongoRepo) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	collection := repo.client.Database("Acordia").Collection("api_keys")
+	var key models.APIKey
+	err := collection.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (repo *MongoRepo) ListAPIKeys(ctx context.Context, createdBy primitive.ObjectID) ([]models.APIKey, error) {
+	collection := repo.client.Database("Acordia").Collection("api_keys")
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"created_by": createdBy}, opts)
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.APIKey{}
+	err = cursor.All(ctx, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (repo *MongoRepo) RevokeAPIKey(ctx context.Context, id string, createdBy primitive.ObjectID) error {
+	collection := repo.client.Database("Acordia").Collection("api_keys")
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": oid, "created_by": createdBy}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *MongoRepo) RevokeUserAPIKeys(ctx context.Context, userId primitive.ObjectID) error {
+	collection := repo.client.Database("Acordia").Collection("api_keys")
+	filter := bson.M{"$or": bson.A{bson.M{"user_id": userId}, bson.M{"created_by": userId}}}
+	_, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+func (repo *MongoRepo) TouchAPIKey(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	collection := repo.client.Database("Acordia").Collection("api_keys")
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": now}})
+	return err
+}
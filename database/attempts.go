@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (repo *MongoRepo) GetLoginAttempts(ctx context.Context, key string, now time.Time) (*models.LoginAttempts, error) {
+	collection := repo.client.Database("Acordia").Collection("login_attempts")
+	var attempts models.LoginAttempts
+	// The ttl index removes the expired records with some delay
+	err := collection.FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": now}}).Decode(&attempts)
+	if err == mongo.ErrNoDocuments {
+		return &models.LoginAttempts{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+func (repo *MongoRepo) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginAttempts, error) {
+	collection := repo.client.Database("Acordia").Collection("login_attempts")
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, err
+	}
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure": now, "expires_at": now.Add(window)},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var attempts models.LoginAttempts
+	err = collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&attempts)
+	if err != nil {
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+func (repo *MongoRepo) ClearLoginAttempts(ctx context.Context, key string) error {
+	collection := repo.client.Database("Acordia").Collection("login_attempts")
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,13 @@
+package database
+
+import (
+	"context"
+
+	"github.com/dg/acordia/models"
+)
+
+func (repo *MongoRepo) AddAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	collection := repo.client.Database("Acordia").Collection("audit_log")
+	_, err := collection.InsertOne(ctx, entry)
+	return err
+}
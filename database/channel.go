@@ -2,10 +2,14 @@ package database
 
 import (
 	"context"
+	"regexp"
+	"time"
 
 	"github.com/dg/acordia/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func (repo *MongoRepo) CreateChannel(ctx context.Context, data models.InsertChannel) (*models.Channel, error) {
@@ -59,6 +63,12 @@ func (repo *MongoRepo) UpdateChannel(ctx context.Context, id string, data models
 			update["$set"].(bson.M)[key] = value
 		}
 	}
+	if data.Visibility != "" {
+		update["$set"].(bson.M)["visibility"] = data.Visibility
+	}
+	if data.Tags != nil {
+		update["$set"].(bson.M)["tags"] = data.Tags
+	}
 	_, err = collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
 	if err != nil {
 		return nil, err
@@ -80,6 +90,21 @@ func (repo *MongoRepo) DeleteChannel(ctx context.Context, id string) error {
 	if err != nil {
 		return err
 	}
+	messages := repo.client.Database("Acordia").Collection("messages")
+	_, err = messages.DeleteMany(ctx, bson.M{"channel_id": oid})
+	if err != nil {
+		return err
+	}
+	readStates := repo.client.Database("Acordia").Collection("read_states")
+	_, err = readStates.DeleteMany(ctx, bson.M{"channel_id": oid})
+	if err != nil {
+		return err
+	}
+	invites := repo.client.Database("Acordia").Collection("invites")
+	_, err = invites.DeleteMany(ctx, bson.M{"channel_id": oid})
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -114,7 +139,11 @@ func (repo *MongoRepo) RemoveUser(ctx context.Context, channelId string, userId
 	if err != nil {
 		return nil, err
 	}
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$pull": bson.M{"users": bson.M{"_id": usOid}}})
+	update := bson.M{
+		"$pull":  bson.M{"users": bson.M{"_id": usOid}},
+		"$unset": bson.M{"roles." + userId: ""},
+	}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
 	if err != nil {
 		return nil, err
 	}
@@ -125,21 +154,62 @@ func (repo *MongoRepo) RemoveUser(ctx context.Context, channelId string, userId
 	return updateUser, nil
 }
 
-func (repo *MongoRepo) AddMessagesToChannel(ctx context.Context, data *models.ChannelMessage, channelId string) (*models.Channel, error) {
+func (repo *MongoRepo) SetChannelRole(ctx context.Context, channelId string, userId string, role string) (*models.Channel, error) {
 	collection := repo.client.Database("Acordia").Collection("channels")
 	oid, err := primitive.ObjectIDFromHex(channelId)
 	if err != nil {
 		return nil, err
 	}
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$push": bson.M{"messages": data}})
+	usOid, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
 		return nil, err
 	}
-	updateUser, err := repo.GetChannelById(ctx, channelId)
+	// Only members can have a role
+	filter := bson.M{"_id": oid, "users._id": usOid}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"roles." + usOid.Hex(): role}})
 	if err != nil {
 		return nil, err
 	}
-	return updateUser, nil
+	if result.MatchedCount == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	channel, err := repo.GetChannelById(ctx, channelId)
+	if err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+func (repo *MongoRepo) TransferChannel(ctx context.Context, channelId string, ownerId string, userId string) (*models.Channel, error) {
+	collection := repo.client.Database("Acordia").Collection("channels")
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	ownerOid, err := primitive.ObjectIDFromHex(ownerId)
+	if err != nil {
+		return nil, err
+	}
+	usOid, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+	// Both roles change together and only while the owner still is one, the
+	// creator of a channel from before the roles has no stored role
+	ownerRole := bson.M{"$in": []interface{}{models.RoleOwner, nil}}
+	filter := bson.M{"_id": oid, "users._id": usOid, "roles." + ownerOid.Hex(): ownerRole}
+	update := bson.M{"$set": bson.M{
+		"roles." + usOid.Hex():    models.RoleOwner,
+		"roles." + ownerOid.Hex(): models.RoleAdmin,
+	}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return repo.GetChannelById(ctx, channelId)
 }
 
 func (repo *MongoRepo) ListOfChannels(ctx context.Context, usOid primitive.ObjectID) ([]models.Channel, error) {
@@ -155,3 +225,94 @@ func (repo *MongoRepo) ListOfChannels(ctx context.Context, usOid primitive.Objec
 	}
 	return channels, nil
 }
+
+func (repo *MongoRepo) DiscoverChannels(ctx context.Context, search models.ChannelSearch) ([]models.Channel, error) {
+	collection := repo.client.Database("Acordia").Collection("channels")
+	filter := bson.M{"visibility": models.VisibilityPublic, "archived_at": nil, "deleted_at": nil}
+	if search.Query != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(search.Query), "$options": "i"}
+		filter["$or"] = bson.A{bson.M{"name": pattern}, bson.M{"description": pattern}}
+	}
+	if len(search.Tags) > 0 {
+		filter["tags"] = bson.M{"$all": search.Tags}
+	}
+	if !search.After.IsZero() {
+		filter["_id"] = bson.M{"$lt": search.After}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(search.Limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	channels := []models.Channel{}
+	if err = cursor.All(ctx, &channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func (repo *MongoRepo) OpenDirectChannel(ctx context.Context, data models.InsertChannel) (*models.Channel, bool, error) {
+	collection := repo.client.Database("Acordia").Collection("channels")
+	filter := bson.M{"direct_key": data.DirectKey}
+	opts := options.Update().SetUpsert(true)
+	// Opening a deleted conversation brings it back before it is purged
+	update := bson.M{"$setOnInsert": data, "$unset": bson.M{"deleted_at": "", "purge_at": ""}}
+	result, err := collection.UpdateOne(ctx, filter, update, opts)
+	// Two concurrent upserts can both insert, the unique index keeps one
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+	var channel models.Channel
+	err = collection.FindOne(ctx, filter).Decode(&channel)
+	if err != nil {
+		return nil, false, err
+	}
+	return &channel, result != nil && result.UpsertedID != nil, nil
+}
+
+func (repo *MongoRepo) ArchiveChannel(ctx context.Context, id string, now time.Time) (*models.Channel, error) {
+	return repo.setChannelState(ctx, id, bson.M{"$set": bson.M{"archived_at": now}})
+}
+
+func (repo *MongoRepo) TrashChannel(ctx context.Context, id string, now time.Time, purgeAt time.Time) (*models.Channel, error) {
+	return repo.setChannelState(ctx, id, bson.M{"$set": bson.M{"deleted_at": now, "purge_at": purgeAt}})
+}
+
+func (repo *MongoRepo) RestoreChannel(ctx context.Context, id string) (*models.Channel, error) {
+	return repo.setChannelState(ctx, id, bson.M{"$unset": bson.M{"archived_at": "", "deleted_at": "", "purge_at": ""}})
+}
+
+func (repo *MongoRepo) setChannelState(ctx context.Context, id string, update bson.M) (*models.Channel, error) {
+	collection := repo.client.Database("Acordia").Collection("channels")
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return repo.GetChannelById(ctx, id)
+}
+
+func (repo *MongoRepo) PurgeChannels(ctx context.Context, now time.Time) (int, error) {
+	collection := repo.client.Database("Acordia").Collection("channels")
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{"purge_at": bson.M{"$lte": now}}, opts)
+	if err != nil {
+		return 0, err
+	}
+	var channels []models.Channel
+	if err = cursor.All(ctx, &channels); err != nil {
+		return 0, err
+	}
+	for _, channel := range channels {
+		if err := repo.DeleteChannel(ctx, channel.Id.Hex()); err != nil {
+			return 0, err
+		}
+	}
+	return len(channels), nil
+}
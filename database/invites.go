@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (repo *MongoRepo) CreateInvite(ctx context.Context, invite *models.Invite) error {
+	collection := repo.client.Database("Acordia").Collection("invites")
+	_, err := collection.InsertOne(ctx, invite)
+	return err
+}
+
+func (repo *MongoRepo) GetInviteByCode(ctx context.Context, code string) (*models.Invite, error) {
+	collection := repo.client.Database("Acordia").Collection("invites")
+	var invite models.Invite
+	err := collection.FindOne(ctx, bson.M{"code": code}).Decode(&invite)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (repo *MongoRepo) ListChannelInvites(ctx context.Context, channelId string) ([]models.Invite, error) {
+	collection := repo.client.Database("Acordia").Collection("invites")
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"channel_id": oid}, opts)
+	if err != nil {
+		return nil, err
+	}
+	invites := []models.Invite{}
+	err = cursor.All(ctx, &invites)
+	if err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (repo *MongoRepo) RevokeInvite(ctx context.Context, channelId string, id string) error {
+	collection := repo.client.Database("Acordia").Collection("invites")
+	channelOid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return err
+	}
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": oid, "channel_id": channelOid}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *MongoRepo) UseInvite(ctx context.Context, code string, now time.Time) (*models.Invite, error) {
+	collection := repo.client.Database("Acordia").Collection("invites")
+	filter := bson.M{
+		"code":    code,
+		"revoked": false,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"expires_at": nil}, bson.M{"expires_at": bson.M{"$gt": now}}}},
+			bson.M{"$or": bson.A{bson.M{"max_uses": 0}, bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}}}}},
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var invite models.Invite
+	err := collection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}}, opts).Decode(&invite)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
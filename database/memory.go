@@ -0,0 +1,83 @@
+package database
+
+// in memory storage for local development and tests
+import (
+	"sync"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MemoryRepo struct {
+	mutex    *sync.RWMutex
+	users    map[primitive.ObjectID]models.User
+	channels map[primitive.ObjectID]models.Channel
+	// Insertion order, the natural order mongo uses when no sort is given
+	userOrder    []primitive.ObjectID
+	channelOrder []primitive.ObjectID
+	messages     map[primitive.ObjectID][]models.ChannelMessage
+	readStates   map[readKey]models.ReadState
+	sessions     map[primitive.ObjectID]models.Session
+	userTokens   map[primitive.ObjectID]models.UserToken
+	auditLog     []models.AuditEntry
+	// Failed logins by account or address
+	loginAttempts map[string]models.LoginAttempts
+	apiKeys       map[primitive.ObjectID]models.APIKey
+	oidcLogins    map[string]models.OIDCLogin
+	invites       map[primitive.ObjectID]models.Invite
+}
+
+type readKey struct {
+	user    primitive.ObjectID
+	channel primitive.ObjectID
+}
+
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{
+		mutex:         &sync.RWMutex{},
+		users:         make(map[primitive.ObjectID]models.User),
+		channels:      make(map[primitive.ObjectID]models.Channel),
+		messages:      make(map[primitive.ObjectID][]models.ChannelMessage),
+		readStates:    make(map[readKey]models.ReadState),
+		sessions:      make(map[primitive.ObjectID]models.Session),
+		userTokens:    make(map[primitive.ObjectID]models.UserToken),
+		loginAttempts: make(map[string]models.LoginAttempts),
+		apiKeys:       make(map[primitive.ObjectID]models.APIKey),
+		oidcLogins:    make(map[string]models.OIDCLogin),
+		invites:       make(map[primitive.ObjectID]models.Invite),
+	}
+}
+
+// Reset drops everything, so tests can share one repository while the
+// goroutines of the previous test may still be using it.
+func (repo *MemoryRepo) Reset() {
+	empty := NewMemoryRepo()
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.users = empty.users
+	repo.channels = empty.channels
+	repo.userOrder = nil
+	repo.channelOrder = nil
+	repo.messages = empty.messages
+	repo.readStates = empty.readStates
+	repo.sessions = empty.sessions
+	repo.userTokens = empty.userTokens
+	repo.auditLog = nil
+	repo.loginAttempts = empty.loginAttempts
+	repo.apiKeys = empty.apiKeys
+	repo.oidcLogins = empty.oidcLogins
+	repo.invites = empty.invites
+}
+
+func (repo *MemoryRepo) Close() error {
+	return nil
+}
+
+func removeId(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	for i, current := range ids {
+		if current == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
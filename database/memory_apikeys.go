@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) ListBots(ctx context.Context, ownerId primitive.ObjectID) ([]models.Profile, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	profiles := []models.Profile{}
+	for _, oid := range repo.userOrder {
+		user := repo.users[oid]
+		if user.Bot && user.OwnerId != nil && *user.OwnerId == ownerId {
+			profiles = append(profiles, profileOf(user))
+		}
+	}
+	return profiles, nil
+}
+
+func (repo *MemoryRepo) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.apiKeys[key.Id] = copyAPIKey(*key)
+	return nil
+}
+
+func (repo *MemoryRepo) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	for _, key := range repo.apiKeys {
+		if key.Prefix == prefix {
+			found := copyAPIKey(key)
+			return &found, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (repo *MemoryRepo) ListAPIKeys(ctx context.Context, createdBy primitive.ObjectID) ([]models.APIKey, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	keys := []models.APIKey{}
+	for _, key := range repo.apiKeys {
+		if key.CreatedBy == createdBy {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (repo *MemoryRepo) RevokeAPIKey(ctx context.Context, id string, createdBy primitive.ObjectID) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	key, ok := repo.apiKeys[oid]
+	if !ok || key.CreatedBy != createdBy {
+		return mongo.ErrNoDocuments
+	}
+	key.Revoked = true
+	repo.apiKeys[oid] = key
+	return nil
+}
+
+func (repo *MemoryRepo) RevokeUserAPIKeys(ctx context.Context, userId primitive.ObjectID) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for oid, key := range repo.apiKeys {
+		if key.UserId == userId || key.CreatedBy == userId {
+			key.Revoked = true
+			repo.apiKeys[oid] = key
+		}
+	}
+	return nil
+}
+
+func (repo *MemoryRepo) TouchAPIKey(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if key, ok := repo.apiKeys[id]; ok {
+		key.LastUsedAt = &now
+		repo.apiKeys[id] = key
+	}
+	return nil
+}
+
+func copyAPIKey(key models.APIKey) models.APIKey {
+	key.Scopes = append([]string{}, key.Scopes...)
+	return key
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+)
+
+func (repo *MemoryRepo) GetLoginAttempts(ctx context.Context, key string, now time.Time) (*models.LoginAttempts, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	attempts, ok := repo.loginAttempts[key]
+	if !ok || !now.Before(attempts.ExpiresAt) {
+		return &models.LoginAttempts{Key: key}, nil
+	}
+	return &attempts, nil
+}
+
+func (repo *MemoryRepo) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginAttempts, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	// Expired records are dropped here, mongo does it with a ttl index
+	for current, attempts := range repo.loginAttempts {
+		if !now.Before(attempts.ExpiresAt) {
+			delete(repo.loginAttempts, current)
+		}
+	}
+	attempts := repo.loginAttempts[key]
+	attempts.Key = key
+	attempts.Failures++
+	attempts.LastFailure = now
+	attempts.ExpiresAt = now.Add(window)
+	repo.loginAttempts[key] = attempts
+	return &attempts, nil
+}
+
+func (repo *MemoryRepo) ClearLoginAttempts(ctx context.Context, key string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	delete(repo.loginAttempts, key)
+	return nil
+}
@@ -0,0 +1,14 @@
+package database
+
+import (
+	"context"
+
+	"github.com/dg/acordia/models"
+)
+
+func (repo *MemoryRepo) AddAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.auditLog = append(repo.auditLog, *entry)
+	return nil
+}
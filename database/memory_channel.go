@@ -0,0 +1,389 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) CreateChannel(ctx context.Context, data models.InsertChannel) (*models.Channel, error) {
+	repo.mutex.Lock()
+	oid := repo.insertChannel(data)
+	repo.mutex.Unlock()
+	return repo.GetChannelById(ctx, oid.Hex())
+}
+
+// insertChannel stores a new channel, the mutex must be held.
+func (repo *MemoryRepo) insertChannel(data models.InsertChannel) primitive.ObjectID {
+	oid := primitive.NewObjectID()
+	repo.channels[oid] = models.Channel{
+		Id:                  oid,
+		Users:               storedProfiles(data.Users),
+		Roles:               copyRoles(data.Roles),
+		Color:               data.Color,
+		Background:          data.Background,
+		DesertRefBackground: data.DesertRefBackground,
+		Image:               data.Image,
+		DesertRefImage:      data.DesertRefImage,
+		CreateDate:          data.CreateDate,
+		Description:         data.Description,
+		Name:                data.Name,
+		Visibility:          data.Visibility,
+		Tags:                append([]string(nil), data.Tags...),
+		Kind:                data.Kind,
+		DirectKey:           data.DirectKey,
+	}
+	repo.channelOrder = append(repo.channelOrder, oid)
+	return oid
+}
+
+func (repo *MemoryRepo) GetChannelById(ctx context.Context, id string) (*models.Channel, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	channel, ok := repo.channels[oid]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	channel = copyChannel(channel)
+	return &channel, nil
+}
+
+func (repo *MemoryRepo) UpdateChannel(ctx context.Context, id string, data models.UpdateChannel) (*models.Channel, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	if channel, ok := repo.channels[oid]; ok {
+		setIfNotEmpty(&channel.Name, data.Name)
+		setIfNotEmpty(&channel.Description, data.Description)
+		setIfNotEmpty(&channel.Color, data.Color)
+		setIfNotEmpty(&channel.Background, data.Background)
+		setIfNotEmpty(&channel.DesertRefBackground, data.DesertRefBackground)
+		setIfNotEmpty(&channel.Image, data.Image)
+		setIfNotEmpty(&channel.DesertRefImage, data.DesertRefImage)
+		setIfNotEmpty(&channel.Visibility, data.Visibility)
+		if data.Tags != nil {
+			channel.Tags = append([]string(nil), data.Tags...)
+		}
+		repo.channels[oid] = channel
+	}
+	repo.mutex.Unlock()
+	return repo.GetChannelById(ctx, id)
+}
+
+func (repo *MemoryRepo) DeleteChannel(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	delete(repo.channels, oid)
+	delete(repo.messages, oid)
+	for key := range repo.readStates {
+		if key.channel == oid {
+			delete(repo.readStates, key)
+		}
+	}
+	for inviteId, invite := range repo.invites {
+		if invite.ChannelId == oid {
+			delete(repo.invites, inviteId)
+		}
+	}
+	repo.channelOrder = removeId(repo.channelOrder, oid)
+	return nil
+}
+
+func (repo *MemoryRepo) AddUserToChannel(ctx context.Context, userId string, channelId string) (*models.Channel, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := repo.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	if channel, ok := repo.channels[oid]; ok {
+		// $addToSet only skips exact copies of the same document
+		exists := false
+		for _, user := range channel.Users {
+			if sameProfile(user, *profile) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			channel.Users = append(channel.Users, storedProfile(*profile))
+			repo.channels[oid] = channel
+		}
+	}
+	repo.mutex.Unlock()
+	return repo.GetChannelById(ctx, channelId)
+}
+
+func (repo *MemoryRepo) RemoveUser(ctx context.Context, channelId string, userId string) (*models.Channel, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	usOid, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	if channel, ok := repo.channels[oid]; ok {
+		users := []models.Profile{}
+		for _, user := range channel.Users {
+			if user.Id != usOid {
+				users = append(users, user)
+			}
+		}
+		channel.Users = users
+		delete(channel.Roles, usOid.Hex())
+		repo.channels[oid] = channel
+	}
+	repo.mutex.Unlock()
+	return repo.GetChannelById(ctx, channelId)
+}
+
+func (repo *MemoryRepo) SetChannelRole(ctx context.Context, channelId string, userId string, role string) (*models.Channel, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	usOid, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	channel, ok := repo.channels[oid]
+	member := false
+	if ok {
+		for _, user := range channel.Users {
+			if user.Id == usOid {
+				member = true
+			}
+		}
+	}
+	if !member {
+		repo.mutex.Unlock()
+		return nil, mongo.ErrNoDocuments
+	}
+	if channel.Roles == nil {
+		channel.Roles = make(map[string]string)
+	}
+	channel.Roles[usOid.Hex()] = role
+	repo.channels[oid] = channel
+	repo.mutex.Unlock()
+	return repo.GetChannelById(ctx, channelId)
+}
+
+func (repo *MemoryRepo) TransferChannel(ctx context.Context, channelId string, ownerId string, userId string) (*models.Channel, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	ownerOid, err := primitive.ObjectIDFromHex(ownerId)
+	if err != nil {
+		return nil, err
+	}
+	usOid, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	channel, ok := repo.channels[oid]
+	member := false
+	if ok {
+		for _, user := range channel.Users {
+			if user.Id == usOid {
+				member = true
+			}
+		}
+	}
+	if !member || channel.RoleOf(ownerOid) != models.RoleOwner {
+		repo.mutex.Unlock()
+		return nil, mongo.ErrNoDocuments
+	}
+	if channel.Roles == nil {
+		channel.Roles = make(map[string]string)
+	}
+	channel.Roles[usOid.Hex()] = models.RoleOwner
+	channel.Roles[ownerOid.Hex()] = models.RoleAdmin
+	repo.channels[oid] = channel
+	repo.mutex.Unlock()
+	return repo.GetChannelById(ctx, channelId)
+}
+
+func (repo *MemoryRepo) ListOfChannels(ctx context.Context, usOid primitive.ObjectID) ([]models.Channel, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	channels := []models.Channel{}
+	for _, oid := range repo.channelOrder {
+		channel := repo.channels[oid]
+		for _, user := range channel.Users {
+			if user.Id == usOid {
+				channels = append(channels, copyChannel(channel))
+				break
+			}
+		}
+	}
+	return channels, nil
+}
+
+func (repo *MemoryRepo) OpenDirectChannel(ctx context.Context, data models.InsertChannel) (*models.Channel, bool, error) {
+	repo.mutex.Lock()
+	var found primitive.ObjectID
+	for _, oid := range repo.channelOrder {
+		if repo.channels[oid].DirectKey == data.DirectKey {
+			found = oid
+			break
+		}
+	}
+	created := found.IsZero()
+	if created {
+		found = repo.insertChannel(data)
+	} else if channel := repo.channels[found]; channel.Deleted() {
+		// Opening a deleted conversation brings it back before it is purged
+		channel.DeletedAt = nil
+		channel.PurgeAt = nil
+		repo.channels[found] = channel
+	}
+	repo.mutex.Unlock()
+	channel, err := repo.GetChannelById(ctx, found.Hex())
+	return channel, created, err
+}
+
+func (repo *MemoryRepo) ArchiveChannel(ctx context.Context, id string, now time.Time) (*models.Channel, error) {
+	return repo.setChannelState(ctx, id, func(channel *models.Channel) {
+		channel.ArchivedAt = &now
+	})
+}
+
+func (repo *MemoryRepo) TrashChannel(ctx context.Context, id string, now time.Time, purgeAt time.Time) (*models.Channel, error) {
+	return repo.setChannelState(ctx, id, func(channel *models.Channel) {
+		channel.DeletedAt = &now
+		channel.PurgeAt = &purgeAt
+	})
+}
+
+func (repo *MemoryRepo) RestoreChannel(ctx context.Context, id string) (*models.Channel, error) {
+	return repo.setChannelState(ctx, id, func(channel *models.Channel) {
+		channel.ArchivedAt = nil
+		channel.DeletedAt = nil
+		channel.PurgeAt = nil
+	})
+}
+
+func (repo *MemoryRepo) setChannelState(ctx context.Context, id string, change func(channel *models.Channel)) (*models.Channel, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	channel, ok := repo.channels[oid]
+	if ok {
+		change(&channel)
+		repo.channels[oid] = channel
+	}
+	repo.mutex.Unlock()
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return repo.GetChannelById(ctx, id)
+}
+
+func (repo *MemoryRepo) PurgeChannels(ctx context.Context, now time.Time) (int, error) {
+	repo.mutex.RLock()
+	due := []primitive.ObjectID{}
+	for oid, channel := range repo.channels {
+		if channel.PurgeAt != nil && !channel.PurgeAt.After(now) {
+			due = append(due, oid)
+		}
+	}
+	repo.mutex.RUnlock()
+	for _, oid := range due {
+		if err := repo.DeleteChannel(ctx, oid.Hex()); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+func (repo *MemoryRepo) DiscoverChannels(ctx context.Context, search models.ChannelSearch) ([]models.Channel, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	query := strings.ToLower(search.Query)
+	channels := []models.Channel{}
+	for i := len(repo.channelOrder) - 1; i >= 0 && len(channels) < search.Limit; i-- {
+		channel := repo.channels[repo.channelOrder[i]]
+		// Public is false for archived and deleted channels
+		if !channel.Public() {
+			continue
+		}
+		if !search.After.IsZero() && bytes.Compare(channel.Id[:], search.After[:]) >= 0 {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(channel.Name), query) && !strings.Contains(strings.ToLower(channel.Description), query) {
+			continue
+		}
+		if !hasTags(channel.Tags, search.Tags) {
+			continue
+		}
+		channels = append(channels, copyChannel(channel))
+	}
+	return channels, nil
+}
+
+func hasTags(tags []string, required []string) bool {
+	for _, tag := range required {
+		found := false
+		for _, current := range tags {
+			if current == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Channels are stored by value, the slices have to be copied so callers can
+// not change the stored data.
+func copyChannel(channel models.Channel) models.Channel {
+	channel.Users = append([]models.Profile{}, channel.Users...)
+	channel.Roles = copyRoles(channel.Roles)
+	channel.Tags = append([]string(nil), channel.Tags...)
+	return channel
+}
+
+func copyRoles(roles map[string]string) map[string]string {
+	if roles == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(roles))
+	for user, role := range roles {
+		copied[user] = role
+	}
+	return copied
+}
+
+func setIfNotEmpty(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
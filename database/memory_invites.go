@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) CreateInvite(ctx context.Context, invite *models.Invite) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.invites[invite.Id] = *invite
+	return nil
+}
+
+func (repo *MemoryRepo) GetInviteByCode(ctx context.Context, code string) (*models.Invite, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	for _, invite := range repo.invites {
+		if invite.Code == code {
+			return &invite, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (repo *MemoryRepo) ListChannelInvites(ctx context.Context, channelId string) ([]models.Invite, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	invites := []models.Invite{}
+	for _, invite := range repo.invites {
+		if invite.ChannelId == oid {
+			invites = append(invites, invite)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.After(invites[j].CreatedAt)
+	})
+	return invites, nil
+}
+
+func (repo *MemoryRepo) RevokeInvite(ctx context.Context, channelId string, id string) error {
+	channelOid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return err
+	}
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	invite, ok := repo.invites[oid]
+	if !ok || invite.ChannelId != channelOid {
+		return mongo.ErrNoDocuments
+	}
+	invite.Revoked = true
+	repo.invites[oid] = invite
+	return nil
+}
+
+func (repo *MemoryRepo) UseInvite(ctx context.Context, code string, now time.Time) (*models.Invite, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for oid, invite := range repo.invites {
+		if invite.Code != code {
+			continue
+		}
+		if !invite.Usable(now) {
+			return nil, mongo.ErrNoDocuments
+		}
+		invite.Uses++
+		repo.invites[oid] = invite
+		return &invite, nil
+	}
+	return nil, mongo.ErrNoDocuments
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) AddMessagesToChannel(ctx context.Context, data *models.ChannelMessage, channelId string) (*models.ChannelMessage, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.channels[oid]; !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	var parent *models.ChannelMessage
+	if data.Parent != nil {
+		parent, err = repo.findMessage(channelId, data.Parent.Hex())
+		if err != nil {
+			return nil, err
+		}
+		if parent.Parent != nil {
+			return nil, repository.ErrNestedReply
+		}
+		// Deleted messages can not be answered
+		if parent.Deleted {
+			return nil, mongo.ErrNoDocuments
+		}
+	}
+	message := *data
+	message.Id = primitive.NewObjectID()
+	message.ChannelId = oid
+	message.User = storedProfile(message.User)
+	if parent != nil {
+		parent.ReplyCount++
+		parent.LastReplyAt = message.Date
+	}
+	repo.messages[oid] = append(repo.messages[oid], message)
+	return &message, nil
+}
+
+func (repo *MemoryRepo) ListMessages(ctx context.Context, channelId string, page models.MessagePage) ([]models.ChannelMessage, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	// Messages are appended with increasing ids so the slice is already sorted
+	window := []models.ChannelMessage{}
+	for _, message := range repo.messages[oid] {
+		if page.Parent.IsZero() && message.Parent != nil {
+			continue
+		}
+		if !page.Parent.IsZero() && (message.Parent == nil || *message.Parent != page.Parent) {
+			continue
+		}
+		if !page.Before.IsZero() && bytes.Compare(message.Id[:], page.Before[:]) >= 0 {
+			continue
+		}
+		if !page.After.IsZero() && bytes.Compare(message.Id[:], page.After[:]) <= 0 {
+			continue
+		}
+		window = append(window, copyMessage(message))
+	}
+	if page.Limit > 0 && len(window) > page.Limit {
+		if !page.After.IsZero() && page.Before.IsZero() {
+			window = window[:page.Limit]
+		} else {
+			window = window[len(window)-page.Limit:]
+		}
+	}
+	return window, nil
+}
+
+func (repo *MemoryRepo) GetMessageById(ctx context.Context, channelId string, messageId string) (*models.ChannelMessage, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	message, err := repo.findMessage(channelId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	found := copyMessage(*message)
+	return &found, nil
+}
+
+func (repo *MemoryRepo) UpdateMessage(ctx context.Context, channelId string, messageId string, data models.UpdateMessage) (*models.ChannelMessage, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	message, err := repo.findMessage(channelId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if message.Deleted {
+		return nil, mongo.ErrNoDocuments
+	}
+	setIfNotEmpty(&message.Description, data.Description)
+	setIfNotEmpty(&message.Image, data.Image)
+	setIfNotEmpty(&message.DesertRef, data.DesertRef)
+	setIfNotEmpty(&message.EditedAt, data.EditedAt)
+	updated := copyMessage(*message)
+	return &updated, nil
+}
+
+func (repo *MemoryRepo) DeleteMessage(ctx context.Context, channelId string, messageId string) (*models.ChannelMessage, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	message, err := repo.findMessage(channelId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if message.Deleted {
+		return nil, mongo.ErrNoDocuments
+	}
+	message.Deleted = true
+	message.Description = ""
+	message.Image = ""
+	message.DesertRef = ""
+	message.Reactions = nil
+	deleted := copyMessage(*message)
+	if deleted.Parent != nil {
+		parent, err := repo.findMessage(channelId, deleted.Parent.Hex())
+		if err == nil {
+			// The last reply is the newest one left
+			parent.ReplyCount--
+			parent.LastReplyAt = ""
+			for _, reply := range repo.messages[deleted.ChannelId] {
+				if reply.Parent != nil && *reply.Parent == parent.Id && !reply.Deleted {
+					parent.LastReplyAt = reply.Date
+				}
+			}
+		}
+	}
+	return &deleted, nil
+}
+
+// findMessage returns a pointer into the stored slice, callers must hold the
+// mutex while they use it.
+func (repo *MemoryRepo) findMessage(channelId string, messageId string) (*models.ChannelMessage, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	msgOid, err := primitive.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, err
+	}
+	messages := repo.messages[oid]
+	for i := range messages {
+		if messages[i].Id == msgOid {
+			return &messages[i], nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (repo *MemoryRepo) AddReaction(ctx context.Context, channelId string, messageId string, userId primitive.ObjectID, emoji string) (bool, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	message, err := repo.findMessage(channelId, messageId)
+	if err != nil {
+		return false, err
+	}
+	if message.Deleted {
+		return false, mongo.ErrNoDocuments
+	}
+	for i := range message.Reactions {
+		reaction := &message.Reactions[i]
+		if reaction.Emoji != emoji {
+			continue
+		}
+		for _, user := range reaction.Users {
+			if user == userId {
+				return false, nil
+			}
+		}
+		reaction.Users = append(reaction.Users, userId)
+		return true, nil
+	}
+	message.Reactions = append(message.Reactions, models.MessageReaction{Emoji: emoji, Users: []primitive.ObjectID{userId}})
+	return true, nil
+}
+
+func (repo *MemoryRepo) RemoveReaction(ctx context.Context, channelId string, messageId string, userId primitive.ObjectID, emoji string) (bool, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	message, err := repo.findMessage(channelId, messageId)
+	if err != nil {
+		return false, err
+	}
+	for i := range message.Reactions {
+		reaction := &message.Reactions[i]
+		if reaction.Emoji != emoji {
+			continue
+		}
+		users := []primitive.ObjectID{}
+		for _, user := range reaction.Users {
+			if user != userId {
+				users = append(users, user)
+			}
+		}
+		if len(users) == len(reaction.Users) {
+			return false, nil
+		}
+		if len(users) == 0 {
+			message.Reactions = append(message.Reactions[:i], message.Reactions[i+1:]...)
+		} else {
+			reaction.Users = users
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Like the channels, the reactions are copied so the stored messages are only
+// changed while holding the mutex.
+func copyMessage(message models.ChannelMessage) models.ChannelMessage {
+	if message.Reactions == nil {
+		return message
+	}
+	reactions := make([]models.MessageReaction, len(message.Reactions))
+	for i, reaction := range message.Reactions {
+		reaction.Users = append([]primitive.ObjectID{}, reaction.Users...)
+		reactions[i] = reaction
+	}
+	message.Reactions = reactions
+	return message
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) CreateOIDCLogin(ctx context.Context, login *models.OIDCLogin) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	// Logins that were never finished are dropped here, mongo does it with a
+	// ttl index
+	for stateHash, current := range repo.oidcLogins {
+		if !time.Now().Before(current.ExpiresAt) {
+			delete(repo.oidcLogins, stateHash)
+		}
+	}
+	repo.oidcLogins[login.StateHash] = *login
+	return nil
+}
+
+func (repo *MemoryRepo) UseOIDCLogin(ctx context.Context, stateHash string, now time.Time) (*models.OIDCLogin, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	login, ok := repo.oidcLogins[stateHash]
+	delete(repo.oidcLogins, stateHash)
+	if !ok || !now.Before(login.ExpiresAt) {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &login, nil
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) MarkRead(ctx context.Context, channelId string, userId primitive.ObjectID, messageId string, date string) (*models.ReadState, bool, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	message, err := repo.findMessage(channelId, messageId)
+	if err != nil {
+		return nil, false, err
+	}
+	key := readKey{user: userId, channel: message.ChannelId}
+	state, ok := repo.readStates[key]
+	advanced := !ok || bytes.Compare(state.LastRead[:], message.Id[:]) < 0
+	if advanced {
+		state = models.ReadState{
+			UserId:    userId,
+			ChannelId: message.ChannelId,
+			LastRead:  message.Id,
+			UpdatedAt: date,
+		}
+		repo.readStates[key] = state
+	}
+	return &state, advanced, nil
+}
+
+func (repo *MemoryRepo) GetReadState(ctx context.Context, channelId string, userId primitive.ObjectID) (*models.ReadState, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	state, ok := repo.readStates[readKey{user: userId, channel: oid}]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &state, nil
+}
+
+func (repo *MemoryRepo) ListChannelReadStates(ctx context.Context, channelId string) ([]models.ReadState, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	states := []models.ReadState{}
+	for key, state := range repo.readStates {
+		if key.channel == oid {
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+func (repo *MemoryRepo) CountUnread(ctx context.Context, channelIds []primitive.ObjectID, userId primitive.ObjectID) (map[primitive.ObjectID]models.UnreadCount, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	counts := map[primitive.ObjectID]models.UnreadCount{}
+	for _, oid := range channelIds {
+		state, read := repo.readStates[readKey{user: userId, channel: oid}]
+		count := models.UnreadCount{}
+		for _, message := range repo.messages[oid] {
+			if message.Parent != nil || message.Deleted || message.User.Id == userId {
+				continue
+			}
+			if read && bytes.Compare(message.Id[:], state.LastRead[:]) <= 0 {
+				continue
+			}
+			count.Unread++
+			for _, mention := range message.Mentions {
+				if mention == userId {
+					count.Mentions++
+					break
+				}
+			}
+		}
+		if count.Unread > 0 {
+			counts[oid] = count
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) CreateSession(ctx context.Context, session *models.Session) (*models.Session, error) {
+	repo.mutex.Lock()
+	repo.sessions[session.Id] = *session
+	repo.mutex.Unlock()
+	return repo.GetSessionById(ctx, session.Id.Hex())
+}
+
+func (repo *MemoryRepo) GetSessionById(ctx context.Context, id string) (*models.Session, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	session, ok := repo.sessions[oid]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &session, nil
+}
+
+func (repo *MemoryRepo) RotateSession(ctx context.Context, id string, oldHash string, newHash string, expiresAt time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	session, ok := repo.sessions[oid]
+	if !ok || session.Revoked || session.RefreshHash != oldHash {
+		return mongo.ErrNoDocuments
+	}
+	session.RefreshHash = newHash
+	session.ExpiresAt = expiresAt
+	repo.sessions[oid] = session
+	return nil
+}
+
+func (repo *MemoryRepo) ListUserSessions(ctx context.Context, userId primitive.ObjectID, now time.Time) ([]models.Session, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	sessions := []models.Session{}
+	for _, session := range repo.sessions {
+		if session.UserId == userId && session.Active(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActiveAt.After(sessions[j].LastActiveAt)
+	})
+	return sessions, nil
+}
+
+func (repo *MemoryRepo) TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if session, ok := repo.sessions[id]; ok {
+		session.LastActiveAt = now
+		repo.sessions[id] = session
+	}
+	return nil
+}
+
+func (repo *MemoryRepo) RevokeSession(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if session, ok := repo.sessions[oid]; ok {
+		session.Revoked = true
+		repo.sessions[oid] = session
+	}
+	return nil
+}
+
+func (repo *MemoryRepo) RevokeUserSessions(ctx context.Context, userId primitive.ObjectID, keep primitive.ObjectID) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for oid, session := range repo.sessions {
+		if session.UserId == userId && oid != keep {
+			session.Revoked = true
+			repo.sessions[oid] = session
+		}
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var _ repository.Repository = NewMemoryRepo()
+
+func insertTestUser(t *testing.T, repo *MemoryRepo, name string) *models.Profile {
+	t.Helper()
+	profile, err := repo.InsertUser(context.Background(), &models.InsertUser{
+		Name:  name,
+		Email: name + "@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile
+}
+
+func TestMemoryUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice := insertTestUser(t, repo, "alice")
+
+	user, err := repo.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil || user.Id != alice.Id {
+		t.Fatalf("got %v, %v for the email of alice", user, err)
+	}
+	if _, err := repo.GetUserById(ctx, primitive.NewObjectID().Hex()); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("got %v for a missing user, want mongo.ErrNoDocuments", err)
+	}
+
+	// Empty fields are left as they are
+	updated, err := repo.UpdateUser(ctx, models.UpdateUser{Id: alice.Id.Hex(), Name: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Alice" || updated.Email != "alice@example.com" {
+		t.Fatalf("got the profile %+v after the update", updated)
+	}
+
+	if err := repo.DeleteUser(ctx, alice.Id.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "alice@example.com"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("got %v for a deleted user, want mongo.ErrNoDocuments", err)
+	}
+}
+
+func TestMemoryChannelMembers(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice, bob := insertTestUser(t, repo, "alice"), insertTestUser(t, repo, "bob")
+	channel, err := repo.CreateChannel(ctx, models.InsertChannel{
+		Name:  "general",
+		Users: []models.Profile{*alice},
+		Roles: map[string]string{alice.Id.Hex(): models.RoleOwner},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := channel.Id.Hex()
+
+	// The answer is a copy, changing it does not change the stored channel
+	channel.Users[0].Name = "changed"
+	channel.Roles[alice.Id.Hex()] = models.RoleMember
+	stored, err := repo.GetChannelById(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Users[0].Name != alice.Name || stored.RoleOf(alice.Id) != models.RoleOwner {
+		t.Fatal("the stored channel changed with the copy")
+	}
+
+	for i := 0; i < 2; i++ {
+		channel, err = repo.AddUserToChannel(ctx, bob.Id.Hex(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(channel.Users) != 2 {
+		t.Fatalf("the channel has %d users, want 2", len(channel.Users))
+	}
+	listed, err := repo.ListOfChannels(ctx, bob.Id)
+	if err != nil || len(listed) != 1 {
+		t.Fatalf("listed %d channels of bob, %v", len(listed), err)
+	}
+
+	channel, err = repo.RemoveUser(ctx, id, bob.Id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channel.Users) != 1 || channel.RoleOf(bob.Id) != "" {
+		t.Fatalf("bob is still in the channel: %+v", channel)
+	}
+	listed, err = repo.ListOfChannels(ctx, bob.Id)
+	if err != nil || len(listed) != 0 {
+		t.Fatalf("listed %d channels of bob after the removal, %v", len(listed), err)
+	}
+	if _, err := repo.GetChannelById(ctx, primitive.NewObjectID().Hex()); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("got %v for a missing channel, want mongo.ErrNoDocuments", err)
+	}
+}
+
+func TestMemoryUniqueEmail(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice, bob := insertTestUser(t, repo, "alice"), insertTestUser(t, repo, "bob")
+
+	_, err := repo.InsertUser(ctx, &models.InsertUser{Name: "Mallory", Email: alice.Email})
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Fatalf("got %v for a registered email, want repository.ErrDuplicateEmail", err)
+	}
+	_, err = repo.UpdateUser(ctx, models.UpdateUser{Id: bob.Id.Hex(), Email: alice.Email})
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Fatalf("got %v changing to a registered email, want repository.ErrDuplicateEmail", err)
+	}
+	// Keeping the same email is not a duplicate
+	if _, err := repo.UpdateUser(ctx, models.UpdateUser{Id: alice.Id.Hex(), Email: alice.Email}); err != nil {
+		t.Fatal(err)
+	}
+	// Bots have no email
+	for i := 0; i < 2; i++ {
+		if _, err := repo.InsertUser(ctx, &models.InsertUser{Name: "bot", Bot: true, OwnerId: &alice.Id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryOpenDeletedDirectChannel(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice, bob := insertTestUser(t, repo, "alice"), insertTestUser(t, repo, "bob")
+	data := models.InsertChannel{
+		Kind:      models.KindDirect,
+		Users:     []models.Profile{*alice, *bob},
+		DirectKey: models.DirectKey(alice.Id, bob.Id),
+	}
+	channel, created, err := repo.OpenDirectChannel(ctx, data)
+	if err != nil || !created {
+		t.Fatalf("got %v, %v opening the conversation", created, err)
+	}
+	now := time.Now()
+	if _, err := repo.TrashChannel(ctx, channel.Id.Hex(), now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, created, err := repo.OpenDirectChannel(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || reopened.Id != channel.Id || reopened.Deleted() {
+		t.Fatalf("got %+v, created %v, want the conversation back", reopened, created)
+	}
+}
+
+func TestMemoryStoredProfiles(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice := insertTestUser(t, repo, "alice")
+	bob, err := repo.InsertUser(ctx, &models.InsertUser{Name: "bob", Email: "bob@example.com", Unverified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, err := repo.InsertUser(ctx, &models.InsertUser{Name: "bot", Bot: true, OwnerId: &alice.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, err := repo.CreateChannel(ctx, models.InsertChannel{
+		Name:  "general",
+		Users: []models.Profile{*bob},
+		Roles: map[string]string{bob.Id.Hex(): models.RoleOwner},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := channel.Id.Hex()
+
+	// The fields mongo does not store do not make a second copy of a member
+	for _, user := range []*models.Profile{bob, bot, bot} {
+		channel, err = repo.AddUserToChannel(ctx, user.Id.Hex(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(channel.Users) != 2 {
+		t.Fatalf("the channel has %d users, want 2", len(channel.Users))
+	}
+	if channel.Users[0].Unverified {
+		t.Fatal("the channel keeps the unverified field of the member")
+	}
+
+	message, err := repo.AddMessagesToChannel(ctx, &models.ChannelMessage{User: *bob, Description: "hi"}, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repo.GetMessageById(ctx, id, message.Id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.User.Unverified {
+		t.Fatal("the message keeps the unverified field of the author")
+	}
+}
+
+func TestMemoryTransferChannel(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice, bob, carol := insertTestUser(t, repo, "alice"), insertTestUser(t, repo, "bob"), insertTestUser(t, repo, "carol")
+	// Channels from before the roles have the creator as owner
+	channel, err := repo.CreateChannel(ctx, models.InsertChannel{
+		Name:  "general",
+		Users: []models.Profile{*alice, *bob, *carol},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := channel.Id.Hex()
+
+	channel, err = repo.TransferChannel(ctx, id, alice.Id.Hex(), bob.Id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.RoleOf(bob.Id) != models.RoleOwner || channel.RoleOf(alice.Id) != models.RoleAdmin {
+		t.Fatalf("the transfer left the roles %v", channel.Roles)
+	}
+	// The previous owner can not transfer the channel again
+	if _, err := repo.TransferChannel(ctx, id, alice.Id.Hex(), carol.Id.Hex()); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("got %v transferring from the previous owner, want mongo.ErrNoDocuments", err)
+	}
+	if _, err := repo.TransferChannel(ctx, id, bob.Id.Hex(), primitive.NewObjectID().Hex()); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("got %v transferring to someone else, want mongo.ErrNoDocuments", err)
+	}
+	channel, err = repo.GetChannelById(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.RoleOf(bob.Id) != models.RoleOwner || channel.RoleOf(carol.Id) != models.RoleMember {
+		t.Fatalf("a failed transfer changed the roles %v", channel.Roles)
+	}
+}
+
+func TestMemoryListMessages(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice := insertTestUser(t, repo, "alice")
+	channel, err := repo.CreateChannel(ctx, models.InsertChannel{Name: "general", Users: []models.Profile{*alice}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := channel.Id.Hex()
+	var posted []*models.ChannelMessage
+	for i := 0; i < 4; i++ {
+		message, err := repo.AddMessagesToChannel(ctx, &models.ChannelMessage{User: *alice}, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		posted = append(posted, message)
+	}
+
+	expect := func(page models.MessagePage, want ...*models.ChannelMessage) {
+		t.Helper()
+		messages, err := repo.ListMessages(ctx, id, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != len(want) {
+			t.Fatalf("listed %d messages, want %d", len(messages), len(want))
+		}
+		for i := range want {
+			if messages[i].Id != want[i].Id {
+				t.Fatalf("message %d is %s, want %s", i, messages[i].Id.Hex(), want[i].Id.Hex())
+			}
+		}
+	}
+	expect(models.MessagePage{}, posted...)
+	expect(models.MessagePage{Limit: 2}, posted[2], posted[3])
+	expect(models.MessagePage{Limit: 2, Before: posted[2].Id}, posted[0], posted[1])
+	expect(models.MessagePage{Limit: 2, After: posted[0].Id}, posted[1], posted[2])
+	expect(models.MessagePage{Before: posted[3].Id, After: posted[0].Id}, posted[1], posted[2])
+}
+
+func TestMemoryReplies(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice := insertTestUser(t, repo, "alice")
+	channel, err := repo.CreateChannel(ctx, models.InsertChannel{Name: "general", Users: []models.Profile{*alice}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := channel.Id.Hex()
+	message, err := repo.AddMessagesToChannel(ctx, &models.ChannelMessage{User: *alice, Date: "2022-01-01 10:00:00"}, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replies []*models.ChannelMessage
+	for _, date := range []string{"2022-01-01 10:01:00", "2022-01-01 10:02:00"} {
+		reply, err := repo.AddMessagesToChannel(ctx, &models.ChannelMessage{User: *alice, Date: date, Parent: &message.Id}, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, reply)
+	}
+	if _, err := repo.AddMessagesToChannel(ctx, &models.ChannelMessage{User: *alice, Parent: &replies[0].Id}, id); !errors.Is(err, repository.ErrNestedReply) {
+		t.Fatalf("got %v replying to a reply, want repository.ErrNestedReply", err)
+	}
+	thread := func() (*models.ChannelMessage, []models.ChannelMessage) {
+		t.Helper()
+		parent, err := repo.GetMessageById(ctx, id, message.Id.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		listed, err := repo.ListMessages(ctx, id, models.MessagePage{Parent: message.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parent, listed
+	}
+	parent, listed := thread()
+	if parent.ReplyCount != 2 || parent.LastReplyAt != replies[1].Date || len(listed) != 2 {
+		t.Fatalf("the thread has %d replies, the last at %q, and lists %d", parent.ReplyCount, parent.LastReplyAt, len(listed))
+	}
+
+	// The last reply is the newest one left
+	for i, want := range []string{replies[0].Date, ""} {
+		if _, err := repo.DeleteMessage(ctx, id, replies[len(replies)-1-i].Id.Hex()); err != nil {
+			t.Fatal(err)
+		}
+		parent, _ = thread()
+		if parent.ReplyCount != 1-i || parent.LastReplyAt != want {
+			t.Fatalf("the thread has %d replies, the last at %q, want %d and %q", parent.ReplyCount, parent.LastReplyAt, 1-i, want)
+		}
+	}
+}
+
+func TestMemoryReset(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	alice := insertTestUser(t, repo, "alice")
+	if _, err := repo.CreateChannel(ctx, models.InsertChannel{
+		Name:  "general",
+		Users: []models.Profile{*alice},
+		Roles: map[string]string{alice.Id.Hex(): models.RoleOwner},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo.Reset()
+	if _, err := repo.GetUserByEmail(ctx, "alice@example.com"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("got %v for the email after the reset, want mongo.ErrNoDocuments", err)
+	}
+	if channels, err := repo.ListOfChannels(ctx, alice.Id); err != nil || len(channels) != 0 {
+		t.Fatalf("listed %d channels after the reset, %v", len(channels), err)
+	}
+	// The emails are free again
+	insertTestUser(t, repo, "alice")
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) CreateUserToken(ctx context.Context, token *models.UserToken) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.userTokens[token.Id] = *token
+	return nil
+}
+
+func (repo *MemoryRepo) UseUserToken(ctx context.Context, purpose string, hash string, now time.Time) (*models.UserToken, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	var used *models.UserToken
+	for oid, token := range repo.userTokens {
+		if token.Purpose == purpose && token.Hash == hash && !token.Used && now.Before(token.ExpiresAt) {
+			token.Used = true
+			repo.userTokens[oid] = token
+			current := token
+			used = &current
+		}
+	}
+	if used == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	for oid, token := range repo.userTokens {
+		if token.UserId == used.UserId && token.Purpose == purpose {
+			token.Used = true
+			repo.userTokens[oid] = token
+		}
+	}
+	return used, nil
+}
+
+func (repo *MemoryRepo) LatestUserToken(ctx context.Context, userId primitive.ObjectID, purpose string) (*models.UserToken, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	var latest *models.UserToken
+	for _, token := range repo.userTokens {
+		if token.UserId == userId && token.Purpose == purpose && (latest == nil || token.CreatedAt.After(latest.CreatedAt)) {
+			current := token
+			latest = &current
+		}
+	}
+	if latest == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	return latest, nil
+}
+
+func (repo *MemoryRepo) ExpireUserTokens(ctx context.Context, userId primitive.ObjectID, purpose string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for oid, token := range repo.userTokens {
+		if token.UserId == userId && token.Purpose == purpose {
+			token.Used = true
+			repo.userTokens[oid] = token
+		}
+	}
+	return nil
+}
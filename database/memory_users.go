@@ -0,0 +1,304 @@
+package database
+
+import (
+	"context"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (repo *MemoryRepo) InsertUser(ctx context.Context, user *models.InsertUser) (*models.Profile, error) {
+	repo.mutex.Lock()
+	if repo.emailTaken(user.Email, primitive.NilObjectID) {
+		repo.mutex.Unlock()
+		return nil, repository.ErrDuplicateEmail
+	}
+	oid := primitive.NewObjectID()
+	repo.users[oid] = models.User{
+		Id:          oid,
+		Name:        user.Name,
+		Email:       user.Email,
+		Password:    user.Password,
+		Unverified:  user.Unverified,
+		Bot:         user.Bot,
+		OwnerId:     user.OwnerId,
+		OIDCSubject: user.OIDCSubject,
+	}
+	repo.userOrder = append(repo.userOrder, oid)
+	repo.mutex.Unlock()
+	return repo.GetUserById(ctx, oid.Hex())
+}
+
+func (repo *MemoryRepo) GetUserById(ctx context.Context, id string) (*models.Profile, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	user, ok := repo.users[oid]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	profile := profileOf(user)
+	return &profile, nil
+}
+
+func (repo *MemoryRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	for _, oid := range repo.userOrder {
+		user := repo.users[oid]
+		if user.Email == email {
+			user.TwoFactor = copyTwoFactor(user.TwoFactor)
+			return &user, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (repo *MemoryRepo) GetUserAccountById(ctx context.Context, id string) (*models.User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	user, ok := repo.users[oid]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	user.TwoFactor = copyTwoFactor(user.TwoFactor)
+	return &user, nil
+}
+
+func (repo *MemoryRepo) ListUsers(ctx context.Context) ([]models.Profile, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	var profiles []models.Profile
+	for _, oid := range repo.userOrder {
+		profiles = append(profiles, profileOf(repo.users[oid]))
+	}
+	return profiles, nil
+}
+
+func (repo *MemoryRepo) UpdateUser(ctx context.Context, data models.UpdateUser) (*models.Profile, error) {
+	oid, err := primitive.ObjectIDFromHex(data.Id)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	user, ok := repo.users[oid]
+	if !ok {
+		repo.mutex.Unlock()
+		return nil, mongo.ErrNoDocuments
+	}
+	if data.Name != "" {
+		user.Name = data.Name
+	}
+	if data.Email != "" {
+		if repo.emailTaken(data.Email, oid) {
+			repo.mutex.Unlock()
+			return nil, repository.ErrDuplicateEmail
+		}
+		user.Email = data.Email
+	}
+	if data.Image != "" {
+		user.Image = data.Image
+	}
+	if data.DesertRef != "" {
+		user.DesertRef = data.DesertRef
+	}
+	repo.users[oid] = user
+	repo.mutex.Unlock()
+	return repo.GetUserById(ctx, data.Id)
+}
+
+func (repo *MemoryRepo) DeleteUser(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	delete(repo.users, oid)
+	repo.userOrder = removeId(repo.userOrder, oid)
+	return nil
+}
+
+func (repo *MemoryRepo) SetLastSeen(ctx context.Context, userId primitive.ObjectID, date string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if user, ok := repo.users[userId]; ok {
+		user.LastSeen = date
+		repo.users[userId] = user
+	}
+	return nil
+}
+
+func (repo *MemoryRepo) GetLastSeen(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	lastSeen := make(map[primitive.ObjectID]string)
+	for _, id := range ids {
+		if user, ok := repo.users[id]; ok {
+			lastSeen[id] = user.LastSeen
+		}
+	}
+	return lastSeen, nil
+}
+
+// emailTaken is the unique index on the email of mongo, bots without one are
+// not in it. The caller holds the lock.
+func (repo *MemoryRepo) emailTaken(email string, except primitive.ObjectID) bool {
+	if email == "" {
+		return false
+	}
+	for oid, user := range repo.users {
+		if oid != except && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func profileOf(user models.User) models.Profile {
+	return models.Profile{
+		Id:               user.Id,
+		Name:             user.Name,
+		Email:            user.Email,
+		Image:            user.Image,
+		DesertRef:        user.DesertRef,
+		Unverified:       user.Unverified,
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+		Bot:              user.Bot,
+		OwnerId:          user.OwnerId,
+	}
+}
+
+// storedProfile is the copy of the profile mongo keeps in channels and
+// messages, without the fields that are not stored.
+func storedProfile(profile models.Profile) models.Profile {
+	profile.Unverified = false
+	profile.TwoFactorEnabled = false
+	return profile
+}
+
+func storedProfiles(profiles []models.Profile) []models.Profile {
+	stored := make([]models.Profile, 0, len(profiles))
+	for _, profile := range profiles {
+		stored = append(stored, storedProfile(profile))
+	}
+	return stored
+}
+
+// sameProfile reports if $addToSet sees the two stored copies as the same
+// document, the owner is compared by value.
+func sameProfile(first models.Profile, second models.Profile) bool {
+	if (first.OwnerId == nil) != (second.OwnerId == nil) || (first.OwnerId != nil && *first.OwnerId != *second.OwnerId) {
+		return false
+	}
+	first.OwnerId, second.OwnerId = nil, nil
+	return storedProfile(first) == storedProfile(second)
+}
+
+func (repo *MemoryRepo) SetUserPassword(ctx context.Context, userId primitive.ObjectID, password string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	user, ok := repo.users[userId]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	user.Password = password
+	repo.users[userId] = user
+	return nil
+}
+
+func (repo *MemoryRepo) SetUserVerified(ctx context.Context, userId primitive.ObjectID, verified bool) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	user, ok := repo.users[userId]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	user.Unverified = !verified
+	repo.users[userId] = user
+	return nil
+}
+
+func (repo *MemoryRepo) SetTwoFactor(ctx context.Context, userId primitive.ObjectID, twoFactor *models.TwoFactor) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	user, ok := repo.users[userId]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	user.TwoFactor = copyTwoFactor(twoFactor)
+	repo.users[userId] = user
+	return nil
+}
+
+func (repo *MemoryRepo) UseTwoFactorStep(ctx context.Context, userId primitive.ObjectID, step int64) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	user, ok := repo.users[userId]
+	if !ok || user.TwoFactor == nil || user.TwoFactor.LastStep >= step {
+		return mongo.ErrNoDocuments
+	}
+	user.TwoFactor.LastStep = step
+	return nil
+}
+
+func (repo *MemoryRepo) UseRecoveryCode(ctx context.Context, userId primitive.ObjectID, hash string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	user, ok := repo.users[userId]
+	if !ok || user.TwoFactor == nil {
+		return mongo.ErrNoDocuments
+	}
+	for i, code := range user.TwoFactor.RecoveryCodes {
+		if code == hash {
+			codes := user.TwoFactor.RecoveryCodes
+			user.TwoFactor.RecoveryCodes = append(append([]string{}, codes[:i]...), codes[i+1:]...)
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+// copyTwoFactor keeps the callers from sharing the stored configuration.
+func copyTwoFactor(twoFactor *models.TwoFactor) *models.TwoFactor {
+	if twoFactor == nil {
+		return nil
+	}
+	copied := *twoFactor
+	copied.RecoveryCodes = append([]string{}, twoFactor.RecoveryCodes...)
+	return &copied
+}
+
+func (repo *MemoryRepo) GetUserByOIDCSubject(ctx context.Context, subject string) (*models.User, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	for _, oid := range repo.userOrder {
+		user := repo.users[oid]
+		if user.OIDCSubject == subject {
+			user.TwoFactor = copyTwoFactor(user.TwoFactor)
+			return &user, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (repo *MemoryRepo) SetUserOIDCSubject(ctx context.Context, userId primitive.ObjectID, subject string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	user, ok := repo.users[userId]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	user.OIDCSubject = subject
+	repo.users[userId] = user
+	return nil
+}
@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (repo *MongoRepo) AddMessagesToChannel(ctx context.Context, data *models.ChannelMessage, channelId string) (*models.ChannelMessage, error) {
+	collection := repo.client.Database("Acordia").Collection("messages")
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the channel exists before storing anything
+	_, err = repo.GetChannelById(ctx, channelId)
+	if err != nil {
+		return nil, err
+	}
+	if data.Parent != nil {
+		parent, err := repo.GetMessageById(ctx, channelId, data.Parent.Hex())
+		if err != nil {
+			return nil, err
+		}
+		if parent.Parent != nil {
+			return nil, repository.ErrNestedReply
+		}
+		// Deleted messages can not be answered
+		if parent.Deleted {
+			return nil, mongo.ErrNoDocuments
+		}
+	}
+	message := *data
+	message.Id = primitive.NewObjectID()
+	message.ChannelId = oid
+	_, err = collection.InsertOne(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	if message.Parent != nil {
+		update := bson.M{
+			"$inc": bson.M{"reply_count": 1},
+			"$set": bson.M{"last_reply_at": message.Date},
+		}
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": *message.Parent}, update)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &message, nil
+}
+
+func (repo *MongoRepo) ListMessages(ctx context.Context, channelId string, page models.MessagePage) ([]models.ChannelMessage, error) {
+	collection := repo.client.Database("Acordia").Collection("messages")
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"channel_id": oid, "parent": bson.M{"$exists": false}}
+	if !page.Parent.IsZero() {
+		filter["parent"] = page.Parent
+	}
+	bounds := bson.M{}
+	if !page.Before.IsZero() {
+		bounds["$lt"] = page.Before
+	}
+	if !page.After.IsZero() {
+		bounds["$gt"] = page.After
+	}
+	if len(bounds) > 0 {
+		filter["_id"] = bounds
+	}
+	// Walking forward from an after cursor reads the oldest messages first,
+	// every other page is the newest messages before the cursor.
+	forward := !page.After.IsZero() && page.Before.IsZero()
+	order := -1
+	if forward {
+		order = 1
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: order}}).SetLimit(int64(page.Limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	messages := []models.ChannelMessage{}
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	if !forward {
+		reverseMessages(messages)
+	}
+	return messages, nil
+}
+
+func reverseMessages(messages []models.ChannelMessage) {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+}
+
+func (repo *MongoRepo) GetMessageById(ctx context.Context, channelId string, messageId string) (*models.ChannelMessage, error) {
+	collection := repo.client.Database("Acordia").Collection("messages")
+	filter, err := messageFilter(channelId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	var message models.ChannelMessage
+	err = collection.FindOne(ctx, filter).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (repo *MongoRepo) UpdateMessage(ctx context.Context, channelId string, messageId string, data models.UpdateMessage) (*models.ChannelMessage, error) {
+	collection := repo.client.Database("Acordia").Collection("messages")
+	filter, err := messageFilter(channelId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	filter["deleted"] = bson.M{"$ne": true}
+	update := bson.M{
+		"$set": bson.M{},
+	}
+	iterableData := map[string]interface{}{
+		"description": data.Description,
+		"image":       data.Image,
+		"desert_ref":  data.DesertRef,
+		"edited_at":   data.EditedAt,
+	}
+	for key, value := range iterableData {
+		if value != "" {
+			update["$set"].(bson.M)[key] = value
+		}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var message models.ChannelMessage
+	err = collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (repo *MongoRepo) DeleteMessage(ctx context.Context, channelId string, messageId string) (*models.ChannelMessage, error) {
+	collection := repo.client.Database("Acordia").Collection("messages")
+	filter, err := messageFilter(channelId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	filter["deleted"] = bson.M{"$ne": true}
+	// The message is kept as a tombstone so clients can replace it in place
+	update := bson.M{"$set": bson.M{
+		"deleted":     true,
+		"description": "",
+		"image":       "",
+		"desert_ref":  "",
+		"reactions":   bson.A{},
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var message models.ChannelMessage
+	err = collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	if message.Parent != nil {
+		if err := repo.removeReply(ctx, *message.Parent); err != nil {
+			return nil, err
+		}
+	}
+	return &message, nil
+}
+
+// removeReply updates the thread of the parent after one of its replies was
+// deleted, the last reply is the newest one left.
+func (repo *MongoRepo) removeReply(ctx context.Context, parentId primitive.ObjectID) error {
+	collection := repo.client.Database("Acordia").Collection("messages")
+	update := bson.M{"$inc": bson.M{"reply_count": -1}}
+	var last models.ChannelMessage
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})
+	err := collection.FindOne(ctx, bson.M{"parent": parentId, "deleted": bson.M{"$ne": true}}, opts).Decode(&last)
+	switch {
+	case err == nil:
+		update["$set"] = bson.M{"last_reply_at": last.Date}
+	case errors.Is(err, mongo.ErrNoDocuments):
+		update["$unset"] = bson.M{"last_reply_at": ""}
+	default:
+		return err
+	}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": parentId}, update)
+	return err
+}
+
+func messageFilter(channelId string, messageId string) (bson.M, error) {
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	msgOid, err := primitive.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"_id": msgOid, "channel_id": oid}, nil
+}
+
+func (repo *MongoRepo) AddReaction(ctx context.Context, channelId string, messageId string, userId primitive.ObjectID, emoji string) (bool, error) {
+	collection := repo.client.Database("Acordia").Collection("messages")
+	filter, err := messageFilter(channelId, messageId)
+	if err != nil {
+		return false, err
+	}
+	filter["deleted"] = bson.M{"$ne": true}
+	_, err = repo.GetMessageById(ctx, channelId, messageId)
+	if err != nil {
+		return false, err
+	}
+	// Two attempts, another user may add the same emoji between the updates
+	for attempt := 0; attempt < 2; attempt++ {
+		existing := bson.M{"reactions.emoji": emoji}
+		for key, value := range filter {
+			existing[key] = value
+		}
+		result, err := collection.UpdateOne(ctx, existing, bson.M{"$addToSet": bson.M{"reactions.$.users": userId}})
+		if err != nil {
+			return false, err
+		}
+		if result.MatchedCount > 0 {
+			return result.ModifiedCount > 0, nil
+		}
+		missing := bson.M{"reactions.emoji": bson.M{"$ne": emoji}}
+		for key, value := range filter {
+			missing[key] = value
+		}
+		reaction := models.MessageReaction{Emoji: emoji, Users: []primitive.ObjectID{userId}}
+		result, err = collection.UpdateOne(ctx, missing, bson.M{"$push": bson.M{"reactions": reaction}})
+		if err != nil {
+			return false, err
+		}
+		if result.MatchedCount > 0 {
+			return true, nil
+		}
+	}
+	return false, mongo.ErrNoDocuments
+}
+
+func (repo *MongoRepo) RemoveReaction(ctx context.Context, channelId string, messageId string, userId primitive.ObjectID, emoji string) (bool, error) {
+	collection := repo.client.Database("Acordia").Collection("messages")
+	filter, err := messageFilter(channelId, messageId)
+	if err != nil {
+		return false, err
+	}
+	_, err = repo.GetMessageById(ctx, channelId, messageId)
+	if err != nil {
+		return false, err
+	}
+	existing := bson.M{"reactions.emoji": emoji}
+	for key, value := range filter {
+		existing[key] = value
+	}
+	result, err := collection.UpdateOne(ctx, existing, bson.M{"$pull": bson.M{"reactions.$.users": userId}})
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount == 0 {
+		return false, nil
+	}
+	// Drop the emoji once nobody is using it
+	_, err = collection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"reactions": bson.M{"users": bson.M{"$size": 0}}}})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"log"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type embeddedMessages struct {
+	Id       primitive.ObjectID      `bson:"_id"`
+	Messages []models.ChannelMessage `bson:"messages"`
+}
+
+// MigrateEmbeddedMessages moves the messages that used to live inside the
+// channel documents to the messages collection. Channels are processed one at
+// a time and the old array is removed once its messages are stored. The ids
+// only depend on the channel and the position of the message, so a run that
+// stopped between both steps writes the same messages again instead of
+// duplicating them.
+func (repo *MongoRepo) MigrateEmbeddedMessages(ctx context.Context) (int, error) {
+	channels := repo.client.Database("Acordia").Collection("channels")
+	messages := repo.client.Database("Acordia").Collection("messages")
+	loc, err := time.LoadLocation("America/Bogota")
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := channels.Find(ctx, bson.M{"messages": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	moved := 0
+	for cursor.Next(ctx) {
+		var channel embeddedMessages
+		if err := cursor.Decode(&channel); err != nil {
+			return moved, err
+		}
+		writes := []mongo.WriteModel{}
+		// A date that can not be read takes the one of the message before it,
+		// the first message falls back to the creation of the channel
+		previous := channel.Id.Timestamp()
+		for index, message := range channel.Messages {
+			date, err := time.ParseInLocation("2006-01-02 15:04:05", message.Date, loc)
+			if err != nil {
+				log.Printf("Channel %s message %d has an invalid date %q, using %s", channel.Id.Hex(), index, message.Date, previous)
+				date = previous
+			}
+			previous = date
+			message.Id = legacyMessageId(channel.Id, index, date)
+			message.ChannelId = channel.Id
+			writes = append(writes, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": message.Id}).
+				SetReplacement(message).
+				SetUpsert(true))
+		}
+		if len(writes) > 0 {
+			if _, err := messages.BulkWrite(ctx, writes); err != nil {
+				return moved, err
+			}
+		}
+		_, err = channels.UpdateOne(ctx, bson.M{"_id": channel.Id}, bson.M{"$unset": bson.M{"messages": ""}})
+		if err != nil {
+			return moved, err
+		}
+		moved += len(writes)
+	}
+	return moved, cursor.Err()
+}
+
+// legacyMessageId starts with the original date so the history keeps its
+// order, then the channel and the position of the message, which also keeps
+// the order of the messages sent in the same second.
+func legacyMessageId(channelId primitive.ObjectID, index int, date time.Time) primitive.ObjectID {
+	var id primitive.ObjectID
+	sum := sha256.Sum256(channelId[:])
+	binary.BigEndian.PutUint32(id[0:4], uint32(date.Unix()))
+	copy(id[4:8], sum[:4])
+	binary.BigEndian.PutUint32(id[8:12], uint32(index))
+	return id
+}
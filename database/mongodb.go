@@ -4,6 +4,7 @@ package database
 import (
 	"context"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -21,7 +22,114 @@ func NewMongoRepo(url string) (*MongoRepo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &MongoRepo{client: client}, nil
+	repo := &MongoRepo{client: client}
+	if err = repo.createIndexes(context.Background()); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (repo *MongoRepo) createIndexes(ctx context.Context) error {
+	messages := repo.client.Database("Acordia").Collection("messages")
+	_, err := messages.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "channel_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "parent", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	readStates := repo.client.Database("Acordia").Collection("read_states")
+	_, err = readStates.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "channel_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	sessions := repo.client.Database("Acordia").Collection("sessions")
+	_, err = sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		// Expired sessions are removed by mongo
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	userTokens := repo.client.Database("Acordia").Collection("user_tokens")
+	_, err = userTokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	auditLog := repo.client.Database("Acordia").Collection("audit_log")
+	_, err = auditLog.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+	loginAttempts := repo.client.Database("Acordia").Collection("login_attempts")
+	_, err = loginAttempts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+	apiKeys := repo.client.Database("Acordia").Collection("api_keys")
+	_, err = apiKeys.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "prefix", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "created_by", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	users := repo.client.Database("Acordia").Collection("users")
+	_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "owner_id", Value: 1}}, Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "oidc_subject", Value: 1}}, Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+	// Bots have an empty email, they are left out of the unique index
+	_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+	})
+	if err != nil {
+		return err
+	}
+	oidcLogins := repo.client.Database("Acordia").Collection("oidc_logins")
+	_, err = oidcLogins.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+	channels := repo.client.Database("Acordia").Collection("channels")
+	_, err = channels.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "visibility", Value: 1}, {Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "direct_key", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "purge_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return err
+	}
+	invites := repo.client.Database("Acordia").Collection("invites")
+	_, err = invites.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "channel_id", Value: 1}}},
+	})
+	return err
 }
 
 func (repo *MongoRepo) Close() error {
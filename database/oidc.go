@@ -0,0 +1,25 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (repo *MongoRepo) CreateOIDCLogin(ctx context.Context, login *models.OIDCLogin) error {
+	collection := repo.client.Database("Acordia").Collection("oidc_logins")
+	_, err := collection.InsertOne(ctx, login)
+	return err
+}
+
+func (repo *MongoRepo) UseOIDCLogin(ctx context.Context, stateHash string, now time.Time) (*models.OIDCLogin, error) {
+	collection := repo.client.Database("Acordia").Collection("oidc_logins")
+	var login models.OIDCLogin
+	err := collection.FindOneAndDelete(ctx, bson.M{"_id": stateHash, "expires_at": bson.M{"$gt": now}}).Decode(&login)
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (repo *MongoRepo) MarkRead(ctx context.Context, channelId string, userId primitive.ObjectID, messageId string, date string) (*models.ReadState, bool, error) {
+	collection := repo.client.Database("Acordia").Collection("read_states")
+	message, err := repo.GetMessageById(ctx, channelId, messageId)
+	if err != nil {
+		return nil, false, err
+	}
+	// The marker only moves forward, reading an old message again keeps it
+	filter := bson.M{
+		"user_id":    userId,
+		"channel_id": message.ChannelId,
+		"$or": bson.A{
+			bson.M{"last_read": bson.M{"$lt": message.Id}},
+			bson.M{"last_read": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"last_read": message.Id, "updated_at": date}}
+	result, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The user already read a newer message, the upsert lost
+		result, err = &mongo.UpdateResult{}, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	advanced := result.ModifiedCount > 0 || result.UpsertedCount > 0
+	state, err := repo.GetReadState(ctx, channelId, userId)
+	if err != nil {
+		return nil, false, err
+	}
+	return state, advanced, nil
+}
+
+func (repo *MongoRepo) GetReadState(ctx context.Context, channelId string, userId primitive.ObjectID) (*models.ReadState, error) {
+	collection := repo.client.Database("Acordia").Collection("read_states")
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	var state models.ReadState
+	err = collection.FindOne(ctx, bson.M{"user_id": userId, "channel_id": oid}).Decode(&state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (repo *MongoRepo) ListChannelReadStates(ctx context.Context, channelId string) ([]models.ReadState, error) {
+	collection := repo.client.Database("Acordia").Collection("read_states")
+	oid, err := primitive.ObjectIDFromHex(channelId)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Find(ctx, bson.M{"channel_id": oid})
+	if err != nil {
+		return nil, err
+	}
+	states := []models.ReadState{}
+	if err = cursor.All(ctx, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (repo *MongoRepo) CountUnread(ctx context.Context, channelIds []primitive.ObjectID, userId primitive.ObjectID) (map[primitive.ObjectID]models.UnreadCount, error) {
+	counts := map[primitive.ObjectID]models.UnreadCount{}
+	if len(channelIds) == 0 {
+		return counts, nil
+	}
+	cursor, err := repo.client.Database("Acordia").Collection("read_states").Find(ctx, bson.M{"user_id": userId, "channel_id": bson.M{"$in": channelIds}})
+	if err != nil {
+		return nil, err
+	}
+	states := []models.ReadState{}
+	if err = cursor.All(ctx, &states); err != nil {
+		return nil, err
+	}
+	// Each channel only counts the messages after its read marker
+	read := map[primitive.ObjectID]bool{}
+	unread := bson.A{}
+	for _, state := range states {
+		read[state.ChannelId] = true
+		unread = append(unread, bson.M{"channel_id": state.ChannelId, "_id": bson.M{"$gt": state.LastRead}})
+	}
+	neverRead := bson.A{}
+	for _, id := range channelIds {
+		if !read[id] {
+			neverRead = append(neverRead, id)
+		}
+	}
+	unread = append(unread, bson.M{"channel_id": bson.M{"$in": neverRead}})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"channel_id": bson.M{"$in": channelIds},
+			"parent":     bson.M{"$exists": false},
+			"deleted":    bson.M{"$ne": true},
+			"user._id":   bson.M{"$ne": userId},
+			"$or":        unread,
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$channel_id",
+			"unread": bson.M{"$sum": 1},
+			"mentions": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$in": bson.A{userId, bson.M{"$ifNull": bson.A{"$mentions", bson.A{}}}}}, 1, 0,
+			}}},
+		}}},
+	}
+	cursor, err = repo.client.Database("Acordia").Collection("messages").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		ChannelId          primitive.ObjectID `bson:"_id"`
+		models.UnreadCount `bson:",inline"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		counts[group.ChannelId] = group.UnreadCount
+	}
+	return counts, nil
+}
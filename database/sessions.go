@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (repo *MongoRepo) CreateSession(ctx context.Context, session *models.Session) (*models.Session, error) {
+	collection := repo.client.Database("Acordia").Collection("sessions")
+	_, err := collection.InsertOne(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetSessionById(ctx, session.Id.Hex())
+}
+
+func (repo *MongoRepo) GetSessionById(ctx context.Context, id string) (*models.Session, error) {
+	collection := repo.client.Database("Acordia").Collection("sessions")
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var session models.Session
+	err = collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (repo *MongoRepo) RotateSession(ctx context.Context, id string, oldHash string, newHash string, expiresAt time.Time) error {
+	collection := repo.client.Database("Acordia").Collection("sessions")
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": oid, "refresh_hash": oldHash, "revoked": false}
+	update := bson.M{"$set": bson.M{"refresh_hash": newHash, "expires_at": expiresAt}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (repo *MongoRepo) ListUserSessions(ctx context.Context, userId primitive.ObjectID, now time.Time) ([]models.Session, error) {
+	collection := repo.client.Database("Acordia").Collection("sessions")
+	filter := bson.M{"user_id": userId, "revoked": false, "expires_at": bson.M{"$gt": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "last_active_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	sessions := []models.Session{}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (repo *MongoRepo) TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	collection := repo.client.Database("Acordia").Collection("sessions")
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_active_at": now}})
+	return err
+}
+
+func (repo *MongoRepo) RevokeSession(ctx context.Context, id string) error {
+	collection := repo.client.Database("Acordia").Collection("sessions")
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (repo *MongoRepo) RevokeUserSessions(ctx context.Context, userId primitive.ObjectID, keep primitive.ObjectID) error {
+	collection := repo.client.Database("Acordia").Collection("sessions")
+	filter := bson.M{"user_id": userId, "revoked": false}
+	if !keep.IsZero() {
+		filter["_id"] = bson.M{"$ne": keep}
+	}
+	_, err := collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (repo *MongoRepo) CreateUserToken(ctx context.Context, token *models.UserToken) error {
+	collection := repo.client.Database("Acordia").Collection("user_tokens")
+	_, err := collection.InsertOne(ctx, token)
+	return err
+}
+
+func (repo *MongoRepo) UseUserToken(ctx context.Context, purpose string, hash string, now time.Time) (*models.UserToken, error) {
+	collection := repo.client.Database("Acordia").Collection("user_tokens")
+	filter := bson.M{"purpose": purpose, "hash": hash, "used": false, "expires_at": bson.M{"$gt": now}}
+	update := bson.M{"$set": bson.M{"used": true}}
+	var token models.UserToken
+	err := collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+	_, err = collection.UpdateMany(ctx, bson.M{"user_id": token.UserId, "purpose": purpose, "used": false}, update)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (repo *MongoRepo) ExpireUserTokens(ctx context.Context, userId primitive.ObjectID, purpose string) error {
+	collection := repo.client.Database("Acordia").Collection("user_tokens")
+	_, err := collection.UpdateMany(ctx, bson.M{"user_id": userId, "purpose": purpose, "used": false}, bson.M{"$set": bson.M{"used": true}})
+	return err
+}
+
+func (repo *MongoRepo) LatestUserToken(ctx context.Context, userId primitive.ObjectID, purpose string) (*models.UserToken, error) {
+	collection := repo.client.Database("Acordia").Collection("user_tokens")
+	var token models.UserToken
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	err := collection.FindOne(ctx, bson.M{"user_id": userId, "purpose": purpose}, opts).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 
 	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func (repo *MongoRepo) InsertUser(ctx context.Context, user *models.InsertUser) (profile *models.Profile, err error) {
 	collection := repo.client.Database("Acordia").Collection("users")
 	result, err := collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, repository.ErrDuplicateEmail
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -38,11 +43,15 @@ func (repo *MongoRepo) GetUserById(ctx context.Context, id string) (*models.Prof
 	}
 	// Populate profile
 	var profile = models.Profile{
-		Id:        user.Id,
-		Name:      user.Name,
-		Email:     user.Email,
-		Image:     user.Image,
-		DesertRef: user.DesertRef,
+		Id:               user.Id,
+		Name:             user.Name,
+		Email:            user.Email,
+		Image:            user.Image,
+		DesertRef:        user.DesertRef,
+		Unverified:       user.Unverified,
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+		Bot:              user.Bot,
+		OwnerId:          user.OwnerId,
 	}
 	return &profile, nil
 }
@@ -55,6 +64,19 @@ func (repo *MongoRepo) GetUserByEmail(ctx context.Context, email string) (*model
 	}
 	return &user, nil
 }
+func (repo *MongoRepo) GetUserAccountById(ctx context.Context, id string) (*models.User, error) {
+	collection := repo.client.Database("Acordia").Collection("users")
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	err = collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
 func (repo *MongoRepo) ListUsers(ctx context.Context) ([]models.Profile, error) {
 	collection := repo.client.Database("Acordia").Collection("users")
 	cursor, err := collection.Find(ctx, bson.M{})
@@ -73,11 +95,15 @@ func (repo *MongoRepo) ListUsers(ctx context.Context) ([]models.Profile, error)
 	for _, user := range users {
 		// Populate profile
 		var profile = models.Profile{
-			Id:        user.Id,
-			Name:      user.Name,
-			Email:     user.Email,
-			Image:     user.Image,
-			DesertRef: user.DesertRef,
+			Id:               user.Id,
+			Name:             user.Name,
+			Email:            user.Email,
+			Image:            user.Image,
+			DesertRef:        user.DesertRef,
+			Unverified:       user.Unverified,
+			TwoFactorEnabled: user.TwoFactorEnabled(),
+			Bot:              user.Bot,
+			OwnerId:          user.OwnerId,
 		}
 		profiles = append(profiles, profile)
 	}
@@ -104,6 +130,9 @@ func (repo *MongoRepo) UpdateUser(ctx context.Context, data models.UpdateUser) (
 		}
 	}
 	err = collection.FindOneAndUpdate(ctx, bson.M{"_id": oid}, update).Err()
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, repository.ErrDuplicateEmail
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -125,3 +154,113 @@ func (repo *MongoRepo) DeleteUser(ctx context.Context, id string) error {
 	}
 	return nil
 }
+func (repo *MongoRepo) SetLastSeen(ctx context.Context, userId primitive.ObjectID, date string) error {
+	collection := repo.client.Database("Acordia").Collection("users")
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": userId}, bson.M{"$set": bson.M{"last_seen": date}})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+func (repo *MongoRepo) GetLastSeen(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	collection := repo.client.Database("Acordia").Collection("users")
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return nil, err
+	}
+	lastSeen := make(map[primitive.ObjectID]string)
+	for _, user := range users {
+		lastSeen[user.Id] = user.LastSeen
+	}
+	return lastSeen, nil
+}
+func (repo *MongoRepo) SetUserPassword(ctx context.Context, userId primitive.ObjectID, password string) error {
+	collection := repo.client.Database("Acordia").Collection("users")
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": userId}, bson.M{"$set": bson.M{"password": password}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+func (repo *MongoRepo) SetUserVerified(ctx context.Context, userId primitive.ObjectID, verified bool) error {
+	collection := repo.client.Database("Acordia").Collection("users")
+	update := bson.M{"$unset": bson.M{"unverified": ""}}
+	if !verified {
+		update = bson.M{"$set": bson.M{"unverified": true}}
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": userId}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+func (repo *MongoRepo) SetTwoFactor(ctx context.Context, userId primitive.ObjectID, twoFactor *models.TwoFactor) error {
+	collection := repo.client.Database("Acordia").Collection("users")
+	update := bson.M{"$unset": bson.M{"two_factor": ""}}
+	if twoFactor != nil {
+		update = bson.M{"$set": bson.M{"two_factor": twoFactor}}
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": userId}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+func (repo *MongoRepo) UseTwoFactorStep(ctx context.Context, userId primitive.ObjectID, step int64) error {
+	collection := repo.client.Database("Acordia").Collection("users")
+	filter := bson.M{"_id": userId, "two_factor.last_step": bson.M{"$lt": step}}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"two_factor.last_step": step}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+func (repo *MongoRepo) UseRecoveryCode(ctx context.Context, userId primitive.ObjectID, hash string) error {
+	collection := repo.client.Database("Acordia").Collection("users")
+	filter := bson.M{"_id": userId, "two_factor.recovery_codes": hash}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+func (repo *MongoRepo) GetUserByOIDCSubject(ctx context.Context, subject string) (*models.User, error) {
+	collection := repo.client.Database("Acordia").Collection("users")
+	var user models.User
+	err := collection.FindOne(ctx, bson.M{"oidc_subject": subject}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+func (repo *MongoRepo) SetUserOIDCSubject(ctx context.Context, userId primitive.ObjectID, subject string) error {
+	collection := repo.client.Database("Acordia").Collection("users")
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": userId}, bson.M{"$set": bson.M{"oidc_subject": subject}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordAudit adds the action to the audit log, a failure is logged but does
+// not fail the request that already happened.
+func recordAudit(r *http.Request, userId primitive.ObjectID, action string) {
+	entry := models.AuditEntry{
+		Id:        primitive.NewObjectID(),
+		UserId:    userId,
+		Action:    action,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		CreatedAt: time.Now(),
+	}
+	if err := repository.AddAuditEntry(r.Context(), &entry); err != nil {
+		log.Println("Error writing audit entry:", err)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CreateBotRequest struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Empty to create the key for the caller
+	BotId         string `json:"bot_id"`
+	ExpiresInDays int    `json:"expires_in_days"`
+}
+
+func CreateBotHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		if profile.Bot {
+			responses.Forbidden(w, "Bots can not own bots")
+			return
+		}
+		var req = CreateBotRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Name == "" {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		// Bots have no email nor password, they can only use api keys
+		bot, err := repository.InsertUser(r.Context(), &models.InsertUser{
+			Name:    req.Name,
+			Bot:     true,
+			OwnerId: &profile.Id,
+		})
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		if req.Image != "" {
+			bot, err = repository.UpdateUser(r.Context(), models.UpdateUser{Id: bot.Id.Hex(), Image: req.Image})
+			if err != nil {
+				responses.InternalServerError(w, err.Error())
+				return
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(bot)
+	}
+}
+
+func ListBotsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		bots, err := repository.ListBots(r.Context(), profile.Id)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(bots)
+	}
+}
+
+// DeleteBotHandler deletes the bot and revokes its keys, its messages keep
+// its profile.
+func DeleteBotHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		bot, ok := ownedBot(w, r, profile, params["id"])
+		if !ok {
+			return
+		}
+		err = repository.RevokeUserAPIKeys(r.Context(), bot.Id)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		err = repository.DeleteUser(r.Context(), bot.Id.Hex())
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		responses.DeleteResponse(w, "Bot deleted")
+	}
+}
+
+// CreateAPIKeyHandler answers with the key, it is the only time it is shown.
+func CreateAPIKeyHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		if profile.Bot {
+			responses.Forbidden(w, "Bots can not create api keys")
+			return
+		}
+		var req = CreateAPIKeyRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Name == "" || len(req.Scopes) == 0 || req.ExpiresInDays < 0 {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !models.ValidScope(scope) {
+				responses.BadRequest(w, "Invalid scope "+scope)
+				return
+			}
+		}
+		userId := profile.Id
+		if req.BotId != "" {
+			bot, ok := ownedBot(w, r, profile, req.BotId)
+			if !ok {
+				return
+			}
+			userId = bot.Id
+		}
+		key, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		now := time.Now()
+		apiKey := models.APIKey{
+			Id:        primitive.NewObjectID(),
+			UserId:    userId,
+			CreatedBy: profile.Id,
+			Name:      req.Name,
+			Prefix:    prefix,
+			Hash:      hash,
+			Scopes:    req.Scopes,
+			CreatedAt: now,
+		}
+		if req.ExpiresInDays > 0 {
+			expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+			apiKey.ExpiresAt = &expiresAt
+		}
+		err = repository.CreateAPIKey(r.Context(), &apiKey)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(responses.APIKeyResponse{APIKey: apiKey, Key: key})
+	}
+}
+
+func ListAPIKeysHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		keys, err := repository.ListAPIKeys(r.Context(), profile.Id)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+func RevokeAPIKeyHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		err = repository.RevokeAPIKey(r.Context(), params["id"], profile.Id)
+		if err != nil {
+			responses.NotFound(w, "Api key not found")
+			return
+		}
+		responses.DeleteResponse(w, "Api key revoked")
+	}
+}
+
+// ownedBot writes the error response and returns false when the id is not
+// a bot of the caller.
+func ownedBot(w http.ResponseWriter, r *http.Request, profile *models.Profile, botId string) (*models.Profile, bool) {
+	bot, err := repository.GetUserById(r.Context(), botId)
+	if err != nil || !bot.Bot || bot.OwnerId == nil || *bot.OwnerId != profile.Id {
+		responses.NotFound(w, "Bot not found")
+		return nil, false
+	}
+	return bot, true
+}
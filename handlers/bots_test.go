@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	channel := ts.createChannel(alice, "general")
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/keys", alice.Token, map[string]interface{}{
+		"name":   "reader",
+		"scopes": []string{"messages:everything"},
+	}, nil)
+	var key responses.APIKeyResponse
+	ts.expect(http.StatusCreated, http.MethodPost, "/keys", alice.Token, map[string]interface{}{
+		"name":   "reader",
+		"scopes": []string{models.ScopeMessagesRead},
+	}, &key)
+
+	messages := "/channel/" + channel.Id.Hex() + "/messages"
+	ts.expect(http.StatusOK, http.MethodGet, messages, key.Key, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, messages, key.Key, map[string]string{
+		"description": "hello",
+	}, nil)
+	ts.expect(http.StatusForbidden, http.MethodGet, "/user/profile", key.Key, nil, nil)
+	// A path parameter named like a public route does not make it public
+	reaction := "/channel/" + channel.Id.Hex() + "/message/" + primitive.NewObjectID().Hex() + "/reactions/login"
+	ts.expect(http.StatusForbidden, http.MethodPut, reaction, key.Key, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodPut, reaction, "", nil, nil)
+
+	// Revoked keys stop working and are only revoked by their owner
+	bob := ts.signup("Bob")
+	ts.expect(http.StatusNotFound, http.MethodDelete, "/keys/"+key.Id.Hex(), bob.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodDelete, "/keys/"+key.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodGet, messages, key.Key, nil, nil)
+	var keys []models.APIKey
+	ts.expect(http.StatusOK, http.MethodGet, "/keys", alice.Token, nil, &keys)
+	if len(keys) != 1 || !keys[0].Revoked {
+		t.Fatalf("got the keys %+v, want the revoked key", keys)
+	}
+}
+
+func TestBots(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	channel := ts.createChannel(alice, "general")
+	var bot models.Profile
+	ts.expect(http.StatusCreated, http.MethodPost, "/bots", alice.Token, map[string]string{
+		"name": "Reminders",
+	}, &bot)
+	if !bot.Bot || bot.OwnerId == nil || *bot.OwnerId != alice.Id {
+		t.Fatalf("got the bot %+v", bot)
+	}
+	var bots []models.Profile
+	ts.expect(http.StatusOK, http.MethodGet, "/bots", alice.Token, nil, &bots)
+	if len(bots) != 1 || bots[0].Id != bot.Id {
+		t.Fatalf("got the bots %+v", bots)
+	}
+
+	// Only the owner creates keys for the bot
+	ts.expect(http.StatusNotFound, http.MethodPost, "/keys", bob.Token, map[string]interface{}{
+		"name":   "stolen",
+		"scopes": []string{models.ScopeMessagesWrite},
+		"bot_id": bot.Id.Hex(),
+	}, nil)
+	var key responses.APIKeyResponse
+	ts.expect(http.StatusCreated, http.MethodPost, "/keys", alice.Token, map[string]interface{}{
+		"name":   "poster",
+		"scopes": []string{models.ScopeMessagesWrite},
+		"bot_id": bot.Id.Hex(),
+	}, &key)
+	if key.UserId != bot.Id {
+		t.Fatalf("the key belongs to %s, want the bot %s", key.UserId.Hex(), bot.Id.Hex())
+	}
+
+	// The bot posts as itself once it is a member
+	messages := "/channel/" + channel.Id.Hex() + "/messages"
+	ts.expect(http.StatusForbidden, http.MethodPost, messages, key.Key, map[string]string{"description": "hello"}, nil)
+	ts.addMember(alice, channel, &testUser{Profile: bot})
+	var message models.ChannelMessage
+	ts.expect(http.StatusCreated, http.MethodPost, messages, key.Key, map[string]string{"description": "hello"}, &message)
+	if message.User.Id != bot.Id {
+		t.Fatalf("the message was posted by %s, want the bot %s", message.User.Id.Hex(), bot.Id.Hex())
+	}
+
+	ts.expect(http.StatusNotFound, http.MethodDelete, "/bots/"+bot.Id.Hex(), bob.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodDelete, "/bots/"+bot.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodPost, messages, key.Key, map[string]string{"description": "hello"}, nil)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/dg/acordia/responses"
 	"github.com/dg/acordia/server"
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type InsertChannelRequest struct {
@@ -21,30 +23,46 @@ type InsertChannelRequest struct {
 	DesertRefImage      string `bson:"desert_ref_image" json:"desert_ref_image"`
 	Description         string `bson:"description" json:"description"`
 	Name                string `bson:"name" json:"name"`
-}
-
-type InsertMessageRequest struct {
-	Description string `bson:"description" json:"description"`
-	Image       string `bson:"image" json:"image"`
-	DesertRef   string `bson:"desert_ref" json:"desert_ref"`
+	// Empty for a private channel
+	Visibility string   `bson:"visibility" json:"visibility"`
+	Tags       []string `bson:"tags" json:"tags"`
 }
 
 func CreateChannelHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		// Token validation
-		profile, _ := middleware.ValidateToken(s, w, r)
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
 		// Handle request
 		w.Header().Set("Content-Type", "application/json")
+		if !requireVerified(w, s, profile, "Verify your email to create channels") {
+			return
+		}
 		var req = InsertChannelRequest{}
-		err := json.NewDecoder(r.Body).Decode(&req)
+		err = json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
 			responses.BadRequest(w, "Invalid request")
 			return
 		}
+		if req.Visibility == "" {
+			req.Visibility = models.VisibilityPrivate
+		}
+		if !models.ValidVisibility(req.Visibility) {
+			responses.BadRequest(w, "Invalid visibility")
+			return
+		}
+		tags, err := normalizeTags(req.Tags)
+		if err != nil {
+			responses.BadRequest(w, err.Error())
+			return
+		}
 		users := []models.Profile{*profile}
 		channel := models.InsertChannel{
 			Users:               users,
+			Roles:               map[string]string{profile.Id.Hex(): models.RoleOwner},
 			Color:               req.Color,
 			Background:          req.Background,
 			DesertRefBackground: req.Background,
@@ -52,7 +70,9 @@ func CreateChannelHandler(s server.Server) http.HandlerFunc {
 			DesertRefImage:      req.DesertRefImage,
 			Description:         req.Description,
 			Name:                req.Name,
-			Messages:            []models.ChannelMessage{},
+			Visibility:          req.Visibility,
+			Tags:                tags,
+			Kind:                models.KindChannel,
 		}
 		insertChannel, err := repository.CreateChannel(r.Context(), channel)
 		if err != nil {
@@ -68,14 +88,48 @@ func ListOfChannelsHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		// Token validation
-		profile, _ := middleware.ValidateToken(s, w, r)
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
 		listChannels, err := repository.ListOfChannels(r.Context(), profile.Id)
 		if err != nil {
 			responses.InternalServerError(w, err.Error())
 			return
 		}
+		// ?kind= lists only the channels or the direct messages, ?archived=true
+		// adds the archived channels and ?deleted=true lists only the deleted
+		// ones that can still be restored
+		query := r.URL.Query()
+		kind := query.Get("kind")
+		archived := query.Get("archived") == "true"
+		deleted := query.Get("deleted") == "true"
+		summaries := []responses.ChannelSummary{}
+		ids := []primitive.ObjectID{}
+		for _, channel := range listChannels {
+			if channel.Deleted() != deleted || (channel.Archived() && !archived && !deleted) {
+				continue
+			}
+			summary := conversationSummary(channel, profile.Id)
+			if kind != "" && summary.Kind != kind {
+				continue
+			}
+			summaries = append(summaries, summary)
+			ids = append(ids, channel.Id)
+		}
+		// One query for the counts of every channel
+		unread, err := repository.CountUnread(r.Context(), ids, profile.Id)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		for i := range summaries {
+			summaries[i].Unread = unread[summaries[i].Id].Unread
+			summaries[i].UnreadMentions = unread[summaries[i].Id].Mentions
+		}
 		w.WriteHeader(http.StatusAccepted)
-		json.NewEncoder(w).Encode(listChannels)
+		json.NewEncoder(w).Encode(summaries)
 	}
 }
 
@@ -83,25 +137,53 @@ func UpdateChannelHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		// Token validation
-		profile, _ := middleware.ValidateToken(s, w, r)
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
 		// Handle request
 		params := mux.Vars(r)
 		w.Header().Set("Content-Type", "application/json")
 		var req = models.UpdateChannel{}
-		err := json.NewDecoder(r.Body).Decode(&req)
+		err = json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
 			responses.BadRequest(w, "Invalid request")
 			return
 		}
+		if req.Visibility != "" && !models.ValidVisibility(req.Visibility) {
+			responses.BadRequest(w, "Invalid visibility")
+			return
+		}
+		if req.Tags != nil {
+			if req.Tags, err = normalizeTags(req.Tags); err != nil {
+				responses.BadRequest(w, err.Error())
+				return
+			}
+		}
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
+			return
+		}
+		if channel.IsDirect() {
+			responses.Forbidden(w, "Direct messages can not be renamed or changed")
+			return
+		}
+		if channel.IsConversation() && (req.Visibility == models.VisibilityPublic || req.Tags != nil) {
+			responses.Forbidden(w, "Group direct messages are always private")
+			return
+		}
+		if !requireRole(w, channel, profile, models.RoleAdmin) {
+			return
+		}
 		updateChannel, err := repository.UpdateChannel(r.Context(), params["id"], req)
 		if err != nil {
 			responses.InternalServerError(w, err.Error())
 			return
 		}
 		neededChannelsWs := []string{params["id"]}
-		var stallMessage = models.WebsocketMessage{
-			Code:    "2",
-			Payload: updateChannel,
+		var stallMessage = models.Event{
+			Type:    models.EventChannelUpdated,
+			Payload: models.ChannelPayload{Channel: *updateChannel},
 			User:    profile.Name,
 		}
 		s.Hub().Broadcast(stallMessage, neededChannelsWs)
@@ -114,19 +196,40 @@ func DeleteChannelHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		// Token validation
-		profile, _ := middleware.ValidateToken(s, w, r)
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
 		// Handle request
 		params := mux.Vars(r)
 		w.Header().Set("Content-Type", "application/json")
-		err := repository.DeleteChannel(r.Context(), params["id"])
-		if err != nil {
-			responses.InternalServerError(w, err.Error())
+		if _, ok := authorizeChannel(w, r, profile, params["id"], models.RoleOwner); !ok {
 			return
 		}
+		channelId, _ := primitive.ObjectIDFromHex(params["id"])
+		payload := models.ChannelDeletedPayload{ChannelId: channelId}
+		// The channel is kept for the grace period so the owner can restore it,
+		// without one it is deleted right away
+		grace := s.Config().ChannelDeleteGrace
+		if grace > 0 {
+			now := time.Now()
+			channel, err := repository.TrashChannel(r.Context(), params["id"], now, now.Add(grace))
+			if err != nil {
+				responses.InternalServerError(w, err.Error())
+				return
+			}
+			payload.PurgeAt = channel.PurgeAt
+		} else {
+			err = repository.DeleteChannel(r.Context(), params["id"])
+			if err != nil {
+				responses.InternalServerError(w, err.Error())
+				return
+			}
+		}
 		neededChannelsWs := []string{params["id"]}
-		var stallMessage = models.WebsocketMessage{
-			Code:    "3",
-			Payload: params["id"],
+		var stallMessage = models.Event{
+			Type:    models.EventChannelDeleted,
+			Payload: payload,
 			User:    profile.Name,
 		}
 		s.Hub().Broadcast(stallMessage, neededChannelsWs)
@@ -134,71 +237,134 @@ func DeleteChannelHandler(s server.Server) http.HandlerFunc {
 	}
 }
 
-func AddUserToChannelHandler(s server.Server) http.HandlerFunc {
+// ArchiveChannelHandler makes the channel read only and hides it from the
+// channel list, admins can restore it.
+func ArchiveChannelHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		// Token validation
-		profile, _ := middleware.ValidateToken(s, w, r)
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
 		// Handle request
 		params := mux.Vars(r)
-		w.Header().Set("Content-Type", "application/json")
-		channel, err := repository.AddUserToChannel(r.Context(), params["user"], params["id"])
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleAdmin)
+		if !ok {
+			return
+		}
+		if channel.Archived() {
+			responses.BadRequest(w, "The channel is already archived")
+			return
+		}
+		channel, err = repository.ArchiveChannel(r.Context(), params["id"], time.Now())
 		if err != nil {
 			responses.InternalServerError(w, err.Error())
 			return
 		}
 		neededChannelsWs := []string{params["id"]}
-		var stallMessage = models.WebsocketMessage{
-			Code:    "2",
-			Payload: channel,
+		var stallMessage = models.Event{
+			Type:    models.EventChannelArchived,
+			Payload: models.ChannelPayload{Channel: *channel},
 			User:    profile.Name,
 		}
 		s.Hub().Broadcast(stallMessage, neededChannelsWs)
-		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(channel)
 	}
 }
 
-func AddMessagesToChannelHandler(s server.Server) http.HandlerFunc {
+// RestoreChannelHandler brings back an archived or deleted channel before it
+// is purged. Admins restore archived channels, only the owner restores a
+// deleted one.
+func RestoreChannelHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		// Token validation
-		profile, _ := middleware.ValidateToken(s, w, r)
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
 		// Handle request
 		params := mux.Vars(r)
+		// authorizeChannel does not find deleted channels
+		channel, err := repository.GetChannelById(r.Context(), params["id"])
+		if err != nil {
+			responses.NotFound(w, "Channel not found")
+			return
+		}
+		if channel.RoleOf(profile.Id) == "" {
+			responses.Forbidden(w, "You are not a member of this channel")
+			return
+		}
+		required := models.RoleAdmin
+		if channel.Deleted() {
+			required = models.RoleOwner
+		}
+		if !requireRole(w, channel, profile, required) {
+			return
+		}
+		if !channel.Archived() && !channel.Deleted() {
+			responses.BadRequest(w, "The channel is not archived or deleted")
+			return
+		}
+		channel, err = repository.RestoreChannel(r.Context(), params["id"])
+		if err != nil {
+			responses.NotFound(w, "Channel not found")
+			return
+		}
+		neededChannelsWs := []string{params["id"]}
+		var stallMessage = models.Event{
+			Type:    models.EventChannelRestored,
+			Payload: models.ChannelPayload{Channel: *channel},
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, neededChannelsWs)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(channel)
+	}
+}
+
+func AddUserToChannelHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		var req = InsertMessageRequest{}
-		err := json.NewDecoder(r.Body).Decode(&req)
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
 		if err != nil {
-			responses.BadRequest(w, "Invalid request")
 			return
 		}
-		loc, error := time.LoadLocation("America/Bogota")
-		if error != nil {
-			responses.InternalServerError(w, "Error loading location")
+		// Handle request
+		params := mux.Vars(r)
+		w.Header().Set("Content-Type", "application/json")
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
 			return
 		}
-		message := models.ChannelMessage{
-			User:        *profile,
-			Date:        time.Now().In(loc).Format("2006-01-02 15:04:05"),
-			Description: req.Description,
-			Image:       req.Image,
-			DesertRef:   req.DesertRef,
+		if !canAddMember(w, channel) || !requireRole(w, channel, profile, models.RoleAdmin) {
+			return
 		}
-		insertMessage, err := repository.AddMessagesToChannel(r.Context(), &message, params["id"])
+		member, err := repository.GetUserById(r.Context(), params["user"])
+		if err != nil {
+			responses.NotFound(w, "User not found")
+			return
+		}
+		if !requireVerified(w, s, member, "The user has not verified its email") {
+			return
+		}
+		channel, err = repository.AddUserToChannel(r.Context(), params["user"], params["id"])
 		if err != nil {
 			responses.InternalServerError(w, err.Error())
 			return
 		}
 		neededChannelsWs := []string{params["id"]}
-		var stallMessage = models.WebsocketMessage{
-			Code:    "2",
-			Payload: insertMessage,
+		var stallMessage = models.Event{
+			Type:    models.EventMemberAdded,
+			Payload: models.MemberPayload{Channel: *channel, Member: memberProfile(r.Context(), params["user"])},
 			User:    profile.Name,
 		}
 		s.Hub().Broadcast(stallMessage, neededChannelsWs)
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(insertMessage)
+		json.NewEncoder(w).Encode(channel)
 	}
 }
 
@@ -206,19 +372,30 @@ func RemoveUserHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		// Token validation
-		profile, _ := middleware.ValidateToken(s, w, r)
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
 		// Handle request
 		params := mux.Vars(r)
 		w.Header().Set("Content-Type", "application/json")
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
+			return
+		}
+		if !canRemoveMember(w, channel, profile, params["user"]) {
+			return
+		}
 		removeUser, err := repository.RemoveUser(r.Context(), params["id"], params["user"])
 		if err != nil {
 			responses.InternalServerError(w, err.Error())
 			return
 		}
+		s.Hub().Unsubscribe(params["id"], params["user"])
 		neededChannelsWs := []string{params["id"]}
-		var stallMessage = models.WebsocketMessage{
-			Code:    "2",
-			Payload: removeUser,
+		var stallMessage = models.Event{
+			Type:    models.EventMemberRemoved,
+			Payload: models.MemberPayload{Channel: *removeUser, Member: memberProfile(r.Context(), params["user"])},
 			User:    profile.Name,
 		}
 		s.Hub().Broadcast(stallMessage, neededChannelsWs)
@@ -226,3 +403,14 @@ func RemoveUserHandler(s server.Server) http.HandlerFunc {
 		json.NewEncoder(w).Encode(removeUser)
 	}
 }
+
+// memberProfile is used in the member events, a user that no longer exists is
+// only identified by its id.
+func memberProfile(ctx context.Context, userId string) models.Profile {
+	profile, err := repository.GetUserById(ctx, userId)
+	if err != nil {
+		oid, _ := primitive.ObjectIDFromHex(userId)
+		return models.Profile{Id: oid}
+	}
+	return *profile
+}
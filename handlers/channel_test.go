@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+)
+
+// listChannels returns the channels the user gets from the list.
+func listChannels(ts *testServer, user *testUser, query string) []responses.ChannelSummary {
+	ts.t.Helper()
+	var summaries []responses.ChannelSummary
+	ts.expect(http.StatusAccepted, http.MethodGet, "/channel/list"+query, user.Token, nil, &summaries)
+	return summaries
+}
+
+func (ts *testServer) postMessage(user *testUser, channel models.Channel, text string, mentions ...string) models.ChannelMessage {
+	ts.t.Helper()
+	var message models.ChannelMessage
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel/"+channel.Id.Hex()+"/messages", user.Token, map[string]interface{}{
+		"description": text,
+		"mentions":    mentions,
+	}, &message)
+	return message
+}
+
+func TestListOfChannelsCountsUnread(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	general, random := ts.createChannel(alice, "general"), ts.createChannel(alice, "random")
+	ts.addMember(alice, general, bob)
+	ts.addMember(alice, random, bob)
+
+	ts.postMessage(alice, general, "hello")
+	last := ts.postMessage(alice, general, "hello @bob", bob.Id.Hex())
+	ts.postMessage(alice, random, "hi")
+	// The own messages are never unread
+	ts.postMessage(bob, random, "hi alice")
+
+	unread := func() map[string]responses.ChannelSummary {
+		summaries := map[string]responses.ChannelSummary{}
+		for _, summary := range listChannels(ts, bob, "") {
+			summaries[summary.Name] = summary
+		}
+		return summaries
+	}
+	counts := unread()
+	if counts["general"].Unread != 2 || counts["general"].UnreadMentions != 1 {
+		t.Fatalf("general has %d unread and %d mentions, want 2 and 1", counts["general"].Unread, counts["general"].UnreadMentions)
+	}
+	if counts["random"].Unread != 1 || counts["random"].UnreadMentions != 0 {
+		t.Fatalf("random has %d unread and %d mentions, want 1 and 0", counts["random"].Unread, counts["random"].UnreadMentions)
+	}
+
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/"+general.Id.Hex()+"/read/"+last.Id.Hex(), bob.Token, nil, nil)
+	counts = unread()
+	if counts["general"].Unread != 0 || counts["random"].Unread != 1 {
+		t.Fatalf("after reading general the counts are %d and %d, want 0 and 1", counts["general"].Unread, counts["random"].Unread)
+	}
+}
+
+func TestListOfChannelsAfterLogout(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	ts.createChannel(alice, "general")
+	ts.expect(http.StatusOK, http.MethodPost, "/logout", alice.Token, nil, nil)
+
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/channel/list", alice.Token, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", alice.Token, nil, nil)
+}
+
+func TestArchivedChannelIsReadOnly(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob, carol := ts.signup("Alice"), ts.signup("Bob"), ts.signup("Carol")
+	var channel models.Channel
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel", alice.Token, map[string]string{
+		"name":       "general",
+		"visibility": models.VisibilityPublic,
+	}, &channel)
+	ts.addMember(alice, channel, bob)
+	id := channel.Id.Hex()
+
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/archive", bob.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/"+id+"/archive", alice.Token, nil, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/channel/"+id+"/archive", alice.Token, nil, nil)
+
+	// Archived channels are read only and only listed when asked for
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/messages", bob.Token, map[string]string{
+		"description": "hello",
+	}, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/channel/"+id+"/messages", bob.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPatch, "/channel/event/removeUser/"+id+"/"+bob.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/leave", bob.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/join", carol.Token, nil, nil)
+	if len(listChannels(ts, bob, "")) != 0 || len(listChannels(ts, bob, "?archived=true")) != 1 {
+		t.Fatal("the archived channel is listed by default or missing with ?archived=true")
+	}
+
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/restore", bob.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/"+id+"/restore", alice.Token, nil, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/channel/"+id+"/restore", alice.Token, nil, nil)
+	ts.postMessage(bob, channel, "hello")
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel/"+id+"/join", carol.Token, nil, nil)
+	if len(listChannels(ts, bob, "")) != 1 {
+		t.Fatal("the restored channel is not listed")
+	}
+}
+
+func TestDeletedChannelRestoredByTheOwner(t *testing.T) {
+	ts := newTestServer(t, server.Config{ChannelDeleteGrace: time.Hour})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	channel := ts.createChannel(alice, "general")
+	ts.addMember(alice, channel, bob)
+	ts.expect(http.StatusOK, http.MethodPatch, "/channel/"+channel.Id.Hex()+"/role/"+bob.Id.Hex(), alice.Token, map[string]string{
+		"role": models.RoleAdmin,
+	}, nil)
+	id := channel.Id.Hex()
+
+	ts.expect(http.StatusForbidden, http.MethodDelete, "/channel/delete/"+id, bob.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodDelete, "/channel/delete/"+id, alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/channel/"+id+"/messages", alice.Token, nil, nil)
+	if len(listChannels(ts, alice, "")) != 0 || len(listChannels(ts, alice, "?deleted=true")) != 1 {
+		t.Fatal("the deleted channel is listed by default or missing with ?deleted=true")
+	}
+
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/restore", bob.Token, nil, nil)
+	var restored models.Channel
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/"+id+"/restore", alice.Token, nil, &restored)
+	if restored.Deleted() {
+		t.Fatal("the restored channel is still deleted")
+	}
+	ts.expect(http.StatusOK, http.MethodGet, "/channel/"+id+"/messages", alice.Token, nil, nil)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CreateGroupMessageRequest struct {
+	// Members besides the caller
+	Users []string `json:"users"`
+	Name  string   `json:"name"`
+}
+
+// OpenDirectMessageHandler returns the direct message with the user, it is
+// only created the first time.
+func OpenDirectMessageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		if params["user"] == profile.Id.Hex() {
+			responses.BadRequest(w, "You can not open a direct message with yourself")
+			return
+		}
+		peer, err := repository.GetUserById(r.Context(), params["user"])
+		if err != nil {
+			responses.NotFound(w, "User not found")
+			return
+		}
+		if !requireVerified(w, s, profile, "Verify your email to send direct messages") {
+			return
+		}
+		if !requireVerified(w, s, peer, "The user has not verified its email") {
+			return
+		}
+		channel, created, err := repository.OpenDirectChannel(r.Context(), models.InsertChannel{
+			Users: []models.Profile{*profile, *peer},
+			Roles: map[string]string{
+				profile.Id.Hex(): models.RoleMember,
+				peer.Id.Hex():    models.RoleMember,
+			},
+			Visibility: models.VisibilityPrivate,
+			Kind:       models.KindDirect,
+			DirectKey:  models.DirectKey(profile.Id, peer.Id),
+		})
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		json.NewEncoder(w).Encode(conversationSummary(*channel, profile.Id))
+	}
+}
+
+// CreateGroupMessageHandler starts a small private conversation, the caller
+// owns it and can add members up to models.MaxGroupMembers.
+func CreateGroupMessageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		var req = CreateGroupMessageRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		if !requireVerified(w, s, profile, "Verify your email to send direct messages") {
+			return
+		}
+		users := []models.Profile{*profile}
+		roles := map[string]string{profile.Id.Hex(): models.RoleOwner}
+		for _, userId := range req.Users {
+			if _, ok := roles[userId]; ok {
+				continue
+			}
+			member, err := repository.GetUserById(r.Context(), userId)
+			if err != nil {
+				responses.NotFound(w, "User not found")
+				return
+			}
+			if !requireVerified(w, s, member, "The user "+member.Name+" has not verified its email") {
+				return
+			}
+			users = append(users, *member)
+			roles[userId] = models.RoleMember
+		}
+		if len(users) < 3 || len(users) > models.MaxGroupMembers {
+			responses.BadRequest(w, "Group direct messages have from 3 to "+strconv.Itoa(models.MaxGroupMembers)+" members, open a direct message instead")
+			return
+		}
+		channel, err := repository.CreateChannel(r.Context(), models.InsertChannel{
+			Users:      users,
+			Roles:      roles,
+			Name:       strings.TrimSpace(req.Name),
+			Visibility: models.VisibilityPrivate,
+			Kind:       models.KindGroup,
+		})
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(conversationSummary(*channel, profile.Id))
+	}
+}
+
+// canAddMember writes the error response and returns false when the channel
+// can not take more members.
+func canAddMember(w http.ResponseWriter, channel *models.Channel) bool {
+	if channel.IsDirect() {
+		responses.Forbidden(w, "Members can not be added to direct messages, start a group instead")
+		return false
+	}
+	if channel.Kind == models.KindGroup && len(channel.Users) >= models.MaxGroupMembers {
+		responses.Forbidden(w, "Group direct messages can not have more than "+strconv.Itoa(models.MaxGroupMembers)+" members")
+		return false
+	}
+	return true
+}
+
+// conversationSummary adds what clients show for the channel in the list:
+// direct messages are named after the other members.
+func conversationSummary(channel models.Channel, userId primitive.ObjectID) responses.ChannelSummary {
+	if channel.Kind == "" {
+		channel.Kind = models.KindChannel
+	}
+	summary := responses.ChannelSummary{
+		Channel:      channel,
+		DisplayName:  channel.Name,
+		DisplayImage: channel.Image,
+	}
+	if !channel.IsConversation() {
+		return summary
+	}
+	names := []string{}
+	summary.Peers = []models.Profile{}
+	for _, user := range channel.Users {
+		if user.Id == userId {
+			continue
+		}
+		summary.Peers = append(summary.Peers, user)
+		names = append(names, user.Name)
+	}
+	if channel.IsDirect() && len(summary.Peers) == 1 {
+		summary.DisplayName = summary.Peers[0].Name
+		summary.DisplayImage = summary.Peers[0].Image
+	} else if summary.DisplayName == "" {
+		summary.DisplayName = strings.Join(names, ", ")
+	}
+	return summary
+}
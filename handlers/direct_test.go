@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOpenDirectMessage(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob, carol := ts.signup("Alice"), ts.signup("Bob"), ts.signup("Carol")
+
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/dm/"+alice.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodPost, "/dm/"+primitive.NewObjectID().Hex(), alice.Token, nil, nil)
+	var direct responses.ChannelSummary
+	ts.expect(http.StatusCreated, http.MethodPost, "/dm/"+bob.Id.Hex(), alice.Token, nil, &direct)
+	if direct.Kind != models.KindDirect || direct.DisplayName != "Bob" || len(direct.Peers) != 1 {
+		t.Fatalf("got the direct message %+v", direct)
+	}
+	// Both users get the same conversation back
+	var again responses.ChannelSummary
+	ts.expect(http.StatusOK, http.MethodPost, "/dm/"+alice.Id.Hex(), bob.Token, nil, &again)
+	if again.Id != direct.Id || again.DisplayName != "Alice" {
+		t.Fatalf("got the direct message %+v, want %s named Alice", again, direct.Id.Hex())
+	}
+	ts.postMessage(bob, direct.Channel, "hi alice")
+
+	// Direct messages keep their two members and stay private
+	id := direct.Id.Hex()
+	ts.expect(http.StatusForbidden, http.MethodPatch, "/channel/event/addUser/"+id+"/"+carol.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPatch, "/channel/update/"+id, alice.Token, map[string]string{"name": "renamed"}, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/invites", alice.Token, map[string]interface{}{}, nil)
+	ts.expect(http.StatusForbidden, http.MethodGet, "/channel/"+id+"/messages", carol.Token, nil, nil)
+
+	conversations := listChannels(ts, alice, "?kind="+models.KindDirect)
+	if len(conversations) != 1 || conversations[0].Id != direct.Id || conversations[0].Unread != 1 {
+		t.Fatalf("listed the direct messages %+v", conversations)
+	}
+	ts.createChannel(alice, "general")
+	if channels := listChannels(ts, alice, "?kind="+models.KindChannel); len(channels) != 1 || channels[0].Name != "general" {
+		t.Fatalf("listed the channels %+v", channels)
+	}
+}
+
+func TestGroupMessages(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob, carol, dave := ts.signup("Alice"), ts.signup("Bob"), ts.signup("Carol"), ts.signup("Dave")
+
+	// Two people talk in a direct message
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/dm/group", alice.Token, map[string]interface{}{
+		"users": []string{bob.Id.Hex(), alice.Id.Hex(), bob.Id.Hex()},
+	}, nil)
+	ts.expect(http.StatusNotFound, http.MethodPost, "/dm/group", alice.Token, map[string]interface{}{
+		"users": []string{bob.Id.Hex(), primitive.NewObjectID().Hex()},
+	}, nil)
+	var group responses.ChannelSummary
+	ts.expect(http.StatusCreated, http.MethodPost, "/dm/group", alice.Token, map[string]interface{}{
+		"users": []string{bob.Id.Hex(), carol.Id.Hex()},
+	}, &group)
+	if group.Kind != models.KindGroup || group.DisplayName != "Bob, Carol" || group.RoleOf(alice.Id) != models.RoleOwner {
+		t.Fatalf("got the group %+v", group)
+	}
+
+	// Groups take members up to the limit and never become public
+	id := group.Id.Hex()
+	ts.addMember(alice, group.Channel, dave)
+	ts.expect(http.StatusForbidden, http.MethodPatch, "/channel/update/"+id, alice.Token, map[string]string{
+		"visibility": models.VisibilityPublic,
+	}, nil)
+	for i := len(group.Users) + 1; i < models.MaxGroupMembers; i++ {
+		ts.addMember(alice, group.Channel, ts.signup("Member"+string(rune('A'+i))))
+	}
+	ts.expect(http.StatusForbidden, http.MethodPatch, "/channel/event/addUser/"+id+"/"+ts.signup("Late").Id.Hex(), alice.Token, nil, nil)
+}
+
+func TestDirectMessagesNeedVerifiedEmails(t *testing.T) {
+	ts := newTestServer(t, server.Config{RequireVerifiedEmail: true})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	ts.expect(http.StatusForbidden, http.MethodPost, "/dm/"+bob.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/email/confirm", "", map[string]string{
+		"token": ts.mailCode(alice.Email),
+	}, nil)
+	// The other user has to be verified too
+	ts.expect(http.StatusForbidden, http.MethodPost, "/dm/"+bob.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/email/confirm", "", map[string]string{
+		"token": ts.mailCode(bob.Email),
+	}, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/dm/"+bob.Id.Hex(), alice.Token, nil, nil)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 50
+	maxChannelTags        = 10
+	maxTagLength          = 32
+)
+
+// DiscoverChannelsHandler lists the public channels, the newest first,
+// filtered by ?q= on the name and description and by every ?tag= given.
+func DiscoverChannelsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		search, err := channelSearchFromQuery(r)
+		if err != nil {
+			responses.BadRequest(w, err.Error())
+			return
+		}
+		// Ask for one more channel to know if there is another page
+		requested := search.Limit
+		search.Limit++
+		channels, err := repository.DiscoverChannels(r.Context(), search)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		hasMore := len(channels) > requested
+		if hasMore {
+			channels = channels[:requested]
+		}
+		response := responses.ChannelDirectoryResponse{
+			Channels: []responses.ChannelListing{},
+			HasMore:  hasMore,
+		}
+		for _, channel := range channels {
+			tags := channel.Tags
+			if tags == nil {
+				tags = []string{}
+			}
+			response.Channels = append(response.Channels, responses.ChannelListing{
+				Id:          channel.Id,
+				Name:        channel.Name,
+				Description: channel.Description,
+				Image:       channel.Image,
+				Color:       channel.Color,
+				Tags:        tags,
+				MemberCount: len(channel.Users),
+				Member:      channel.RoleOf(profile.Id) != "",
+			})
+		}
+		if hasMore {
+			response.After = encodeCursor(channels[len(channels)-1].Id)
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// JoinChannelHandler adds the caller to a public channel.
+func JoinChannelHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		channel, err := repository.GetChannelById(r.Context(), params["id"])
+		// Private channels are not found, like in the directory
+		if err != nil || channel.Deleted() || (channel.Visibility != models.VisibilityPublic && channel.RoleOf(profile.Id) == "") {
+			responses.NotFound(w, "Channel not found")
+			return
+		}
+		if channel.RoleOf(profile.Id) != "" {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(channel)
+			return
+		}
+		if !writableChannel(w, channel) {
+			return
+		}
+		if !requireVerified(w, s, profile, "Verify your email to join channels") {
+			return
+		}
+		channel, err = repository.AddUserToChannel(r.Context(), profile.Id.Hex(), params["id"])
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		neededChannelsWs := []string{params["id"]}
+		var stallMessage = models.Event{
+			Type:    models.EventMemberAdded,
+			Payload: models.MemberPayload{Channel: *channel, Member: *profile},
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, neededChannelsWs)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(channel)
+	}
+}
+
+// LeaveChannelHandler removes the caller from the channel, the owner has to
+// transfer it first.
+func LeaveChannelHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
+			return
+		}
+		if !canRemoveMember(w, channel, profile, profile.Id.Hex()) {
+			return
+		}
+		channel, err = repository.RemoveUser(r.Context(), params["id"], profile.Id.Hex())
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		s.Hub().Unsubscribe(params["id"], profile.Id.Hex())
+		neededChannelsWs := []string{params["id"]}
+		var stallMessage = models.Event{
+			Type:    models.EventMemberRemoved,
+			Payload: models.MemberPayload{Channel: *channel, Member: *profile},
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, neededChannelsWs)
+		responses.DeleteResponse(w, "You left the channel")
+	}
+}
+
+func channelSearchFromQuery(r *http.Request) (models.ChannelSearch, error) {
+	query := r.URL.Query()
+	search := models.ChannelSearch{
+		Query: strings.TrimSpace(query.Get("q")),
+		Limit: defaultDirectoryLimit,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return search, errors.New("Invalid limit")
+		}
+		if value > maxDirectoryLimit {
+			value = maxDirectoryLimit
+		}
+		search.Limit = value
+	}
+	tags, err := normalizeTags(query["tag"])
+	if err != nil {
+		return search, err
+	}
+	search.Tags = tags
+	if after := query.Get("after"); after != "" {
+		if search.After, err = decodeCursor(after); err != nil {
+			return search, errors.New("Invalid after cursor")
+		}
+	}
+	return search, nil
+}
+
+// normalizeTags lowercases the tags and drops the empty and repeated ones.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, errors.New("Tags can not be longer than " + strconv.Itoa(maxTagLength) + " characters")
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxChannelTags {
+		return nil, errors.New("A channel can not have more than " + strconv.Itoa(maxChannelTags) + " tags")
+	}
+	return normalized, nil
+}
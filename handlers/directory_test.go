@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+)
+
+func (ts *testServer) createPublicChannel(owner *testUser, name string, description string, tags ...string) models.Channel {
+	ts.t.Helper()
+	var channel models.Channel
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel", owner.Token, map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"visibility":  models.VisibilityPublic,
+		"tags":        tags,
+	}, &channel)
+	return channel
+}
+
+func (ts *testServer) discover(user *testUser, query url.Values) responses.ChannelDirectoryResponse {
+	ts.t.Helper()
+	var directory responses.ChannelDirectoryResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/channel/discover?"+query.Encode(), user.Token, nil, &directory)
+	return directory
+}
+
+// names of the listed channels, in order.
+func names(directory responses.ChannelDirectoryResponse) string {
+	list := []string{}
+	for _, channel := range directory.Channels {
+		list = append(list, channel.Name)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestDiscoverChannels(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	ts.createPublicChannel(alice, "golang", "Gophers", "Go", "programming")
+	ts.createPublicChannel(alice, "rust", "Crabs", "programming")
+	ts.createPublicChannel(alice, "music", "Songs about go")
+	ts.createChannel(alice, "private")
+
+	if got := names(ts.discover(bob, url.Values{})); got != "music,rust,golang" {
+		t.Fatalf("listed %s, want the public channels newest first", got)
+	}
+	if got := names(ts.discover(bob, url.Values{"q": {"GO"}})); got != "music,golang" {
+		t.Fatalf("listed %s for the query, want music,golang", got)
+	}
+	if got := names(ts.discover(bob, url.Values{"tag": {" Programming", "go"}})); got != "golang" {
+		t.Fatalf("listed %s for the tags, want golang", got)
+	}
+
+	// Pages follow the cursor
+	first := ts.discover(bob, url.Values{"limit": {"2"}})
+	if names(first) != "music,rust" || !first.HasMore || first.After == "" {
+		t.Fatalf("got the first page %+v", first)
+	}
+	second := ts.discover(bob, url.Values{"limit": {"2"}, "after": {first.After}})
+	if names(second) != "golang" || second.HasMore {
+		t.Fatalf("got the second page %+v", second)
+	}
+
+	for _, query := range []string{"limit=0", "limit=ten", "after=not-a-cursor", "tag=" + strings.Repeat("a", maxTagLength+1)} {
+		ts.expect(http.StatusBadRequest, http.MethodGet, "/channel/discover?"+query, bob.Token, nil, nil)
+	}
+}
+
+func TestJoinAndLeavePublicChannels(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	public := ts.createPublicChannel(alice, "general", "")
+	private := ts.createChannel(alice, "private")
+
+	// Private channels are not found, like in the directory
+	ts.expect(http.StatusNotFound, http.MethodPost, "/channel/"+private.Id.Hex()+"/join", bob.Token, nil, nil)
+	id := public.Id.Hex()
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel/"+id+"/join", bob.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/"+id+"/join", bob.Token, nil, nil)
+	directory := ts.discover(bob, url.Values{})
+	if len(directory.Channels) != 1 || !directory.Channels[0].Member || directory.Channels[0].MemberCount != 2 {
+		t.Fatalf("got the listing %+v after the join", directory.Channels)
+	}
+	ts.postMessage(bob, public, "hello")
+
+	// The owner has to transfer the channel before leaving it
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/leave", alice.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/"+id+"/leave", bob.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodGet, "/channel/"+id+"/messages", bob.Token, nil, nil)
+	if directory := ts.discover(bob, url.Values{}); directory.Channels[0].Member {
+		t.Fatal("bob is still a member after leaving")
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{" Go ", "go", "", "Rust"})
+	if err != nil || strings.Join(tags, ",") != "go,rust" {
+		t.Fatalf("normalizeTags = %v, %v, want go,rust", tags, err)
+	}
+	many := []string{}
+	for i := 0; i <= maxChannelTags; i++ {
+		many = append(many, strings.Repeat("a", i+1))
+	}
+	if _, err := normalizeTags(many); err == nil {
+		t.Fatal("accepted more than the maximum of tags")
+	}
+}
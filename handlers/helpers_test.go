@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dg/acordia/database"
+	"github.com/dg/acordia/mailer"
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/dg/acordia/websocket"
+	"github.com/gorilla/mux"
+	gorilla "github.com/gorilla/websocket"
+)
+
+// testServer serves the handlers on an empty memory repository. The
+// repository is global, the tests of this package can not run in parallel.
+type testServer struct {
+	t      *testing.T
+	url    string
+	broker *server.Broker
+}
+
+// The hubs of the previous tests keep running and saving the last seen of
+// their users, so the repository is set once and emptied for every test.
+var memoryRepo = database.NewMemoryRepo()
+
+func TestMain(m *testing.M) {
+	repository.SetRepository(memoryRepo)
+	os.Exit(m.Run())
+}
+
+// newTestServer binds the routes like main does, the oidc redirect url
+// points to the test server when it is not set.
+func newTestServer(t *testing.T, config server.Config) *testServer {
+	t.Helper()
+	router := mux.NewRouter()
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	config.Port = ":0"
+	config.DbURI = "memory://"
+	if config.JWTSecret == "" {
+		config.JWTSecret = "test-secret"
+	}
+	if config.OIDC.Issuer != "" && config.OIDC.RedirectURL == "" {
+		config.OIDC.RedirectURL = ts.URL + "/oidc/callback"
+	}
+	broker, err := server.NewServer(context.Background(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memoryRepo.Reset()
+	// The hub has no way to stop, it ends with the tests
+	go broker.Hub().Run()
+	bindRoutes(broker, router)
+	return &testServer{t: t, url: ts.URL, broker: broker}
+}
+
+// bindRoutes is the router of main, main can not be imported.
+func bindRoutes(s server.Server, r *mux.Router) {
+	r.Use(middleware.CheckAuthMiddleware(s))
+	r.HandleFunc("/welcome", HomeHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/.well-known/jwks.json", JWKSHandler(s)).Methods(http.MethodGet)
+
+	//Auth
+	r.HandleFunc("/signup", SignUpHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/login", LoginHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/login/2fa", TwoFactorLoginHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/oidc/login", OIDCLoginHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/oidc/callback", OIDCCallbackHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/token/refresh", RefreshTokenHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/logout", LogoutHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/logout/all", LogoutAllHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/sessions", ListSessionsHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/sessions/{id}", RevokeSessionHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/password/forgot", ForgotPasswordHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/password/reset", ResetPasswordHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/email/confirm", ConfirmEmailHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/email/resend", ResendVerificationHandler(s)).Methods(http.MethodPost)
+
+	//user
+	r.HandleFunc("/user/delete", DeleteUserHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/user/update", UpdateUserHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/user/profile", ProfileHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/user/password", ChangePasswordHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/2fa/enroll", EnrollTwoFactorHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/2fa/confirm", ConfirmTwoFactorHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/2fa/disable", DisableTwoFactorHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/2fa/recovery-codes", RegenerateRecoveryCodesHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/presence", UpdatePresenceHandler(s)).Methods(http.MethodPatch)
+
+	//bots and api keys
+	r.HandleFunc("/bots", CreateBotHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/bots", ListBotsHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/bots/{id}", DeleteBotHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/keys", CreateAPIKeyHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/keys", ListAPIKeysHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/keys/{id}", RevokeAPIKeyHandler(s)).Methods(http.MethodDelete)
+
+	//presence
+	r.HandleFunc("/presence", PresenceHandler(s)).Methods(http.MethodGet)
+
+	//channel
+	r.HandleFunc("/channel", CreateChannelHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/update/{id}", UpdateChannelHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/delete/{id}", DeleteChannelHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/channel/{id}/archive", ArchiveChannelHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/restore", RestoreChannelHandler(s)).Methods(http.MethodPost)
+
+	//events channels
+	r.HandleFunc("/channel/event/addUser/{id}/{user}", AddUserToChannelHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/event/removeUser/{id}/{user}", RemoveUserHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/{id}/role/{user}", SetChannelRoleHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/{id}/invites", CreateInviteHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/invites", ListInvitesHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/{id}/invites/{inviteId}", RevokeInviteHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/channel/event/addMessage/{id}", AddMessagesToChannelHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/list", ListOfChannelsHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/dm/group", CreateGroupMessageHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/dm/{user}", OpenDirectMessageHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/discover", DiscoverChannelsHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/{id}/join", JoinChannelHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/leave", LeaveChannelHandler(s)).Methods(http.MethodPost)
+
+	//invites
+	r.HandleFunc("/invite/{code}", PreviewInviteHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/join/{code}", RedeemInviteHandler(s)).Methods(http.MethodPost)
+
+	//messages
+	r.HandleFunc("/channel/{id}/messages", ListMessagesHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/{id}/messages", CreateMessageHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/message/{messageId}", UpdateMessageHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/{id}/message/{messageId}", DeleteMessageHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/channel/{id}/message/{messageId}/replies", AddReplyHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/message/{messageId}/replies", ListRepliesHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/{id}/message/{messageId}/reactions/{emoji}", AddReactionHandler(s)).Methods(http.MethodPut)
+	r.HandleFunc("/channel/{id}/message/{messageId}/reactions/{emoji}", RemoveReactionHandler(s)).Methods(http.MethodDelete)
+
+	//read states
+	r.HandleFunc("/channel/{id}/read/{messageId}", MarkReadHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/reads", ListReadStatesHandler(s)).Methods(http.MethodGet)
+
+	// WebSocket
+	s.Hub().SetMessagePoster(SocketMessagePoster(s))
+	r.HandleFunc("/ws/{Authorization}/{Channel}", s.Hub().HandleWebSocket(s.Keys()))
+	r.HandleFunc("/protocol/schema.json", websocket.SchemaHandler()).Methods(http.MethodGet)
+}
+
+// do sends the body as json and decodes the answer into out when it is not
+// nil, it returns the status code.
+func (ts *testServer) do(method string, path string, token string, body interface{}, out interface{}) int {
+	ts.t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, ts.url+path, &reader)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			ts.t.Fatalf("%s %s: decoding the answer: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// expect fails the test when the request does not answer with the status.
+func (ts *testServer) expect(status int, method string, path string, token string, body interface{}, out interface{}) {
+	ts.t.Helper()
+	if got := ts.do(method, path, token, body, out); got != status {
+		ts.t.Fatalf("%s %s: got status %d, want %d", method, path, got, status)
+	}
+}
+
+// testUser is an account made with signup, Token is its access token.
+type testUser struct {
+	models.Profile
+	Password string
+	Token    string
+}
+
+func (ts *testServer) signup(name string) *testUser {
+	ts.t.Helper()
+	user := &testUser{Password: "a-long-password-1"}
+	email := strings.ToLower(name) + "@example.com"
+	ts.expect(http.StatusOK, http.MethodPost, "/signup", "", map[string]string{
+		"email":    email,
+		"password": user.Password,
+		"name":     name,
+	}, &user.Profile)
+	user.Token = ts.login(email, user.Password).Token
+	return user
+}
+
+func (ts *testServer) login(email string, password string) responses.LoginResponse {
+	ts.t.Helper()
+	var login responses.LoginResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/login", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, &login)
+	return login
+}
+
+// The verification and password reset mails end the first line with the code
+var mailCodePattern = regexp.MustCompile(`Use this code to [^:]*: (\S+)`)
+
+// mailCode returns the code of the last mail sent to the address.
+func (ts *testServer) mailCode(to string) string {
+	ts.t.Helper()
+	messages := ts.broker.Mailer().(*mailer.MemoryMailer).Messages(to)
+	if len(messages) == 0 {
+		ts.t.Fatalf("no mail sent to %s", to)
+	}
+	match := mailCodePattern.FindStringSubmatch(messages[len(messages)-1].Body)
+	if match == nil {
+		ts.t.Fatalf("no code in the mail sent to %s", to)
+	}
+	return match[1]
+}
+
+func (ts *testServer) createChannel(owner *testUser, name string) models.Channel {
+	ts.t.Helper()
+	var channel models.Channel
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel", owner.Token, map[string]string{
+		"name": name,
+	}, &channel)
+	return channel
+}
+
+func (ts *testServer) addMember(admin *testUser, channel models.Channel, member *testUser) {
+	ts.t.Helper()
+	ts.expect(http.StatusCreated, http.MethodPatch, "/channel/event/addUser/"+channel.Id.Hex()+"/"+member.Id.Hex(), admin.Token, nil, nil)
+}
+
+// dial opens a socket of the user on the websocket channel, without
+// protocols the client is a legacy one.
+func (ts *testServer) dial(user *testUser, channel string, protocols ...string) *gorilla.Conn {
+	ts.t.Helper()
+	dialer := gorilla.Dialer{Subprotocols: protocols}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.url, "http")+"/ws/"+user.Token+"/"+channel, nil)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	ts.t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readFrame skips the frames of the socket until one matches, frames are
+// decoded with the fields of both protocols.
+func (ts *testServer) readFrame(conn *gorilla.Conn, match func(frame testFrame) bool) testFrame {
+	ts.t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame testFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			ts.t.Fatal(err)
+		}
+		if match(frame) {
+			return frame
+		}
+	}
+}
+
+type testFrame struct {
+	Type    models.EventType `json:"type"`
+	Code    string           `json:"code"`
+	Id      string           `json:"id"`
+	Payload json.RawMessage  `json:"payload"`
+}
+
+// waitFor polls the condition, the hub registers the clients after the
+// upgrade answered.
+func (ts *testServer) waitFor(what string, condition func() bool) {
+	ts.t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			ts.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
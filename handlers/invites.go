@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CreateInviteRequest struct {
+	// Empty for members, only the owner can invite admins
+	Role string `json:"role"`
+	// Zero for no limit
+	MaxUses        int `json:"max_uses"`
+	ExpiresInHours int `json:"expires_in_hours"`
+}
+
+// CreateInviteHandler mints a code that lets anyone join the channel.
+func CreateInviteHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		var req = CreateInviteRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.MaxUses < 0 || req.ExpiresInHours < 0 {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		if req.Role == "" {
+			req.Role = models.RoleMember
+		}
+		if req.Role != models.RoleMember && req.Role != models.RoleAdmin {
+			responses.BadRequest(w, "Invalid role")
+			return
+		}
+		required := models.RoleAdmin
+		if req.Role == models.RoleAdmin {
+			required = models.RoleOwner
+		}
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
+			return
+		}
+		if channel.IsConversation() {
+			responses.Forbidden(w, "Direct messages can not have invites")
+			return
+		}
+		if !requireRole(w, channel, profile, required) {
+			return
+		}
+		code, err := auth.RandomToken(8)
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		now := time.Now()
+		invite := models.Invite{
+			Id:        primitive.NewObjectID(),
+			Code:      code,
+			ChannelId: channel.Id,
+			CreatedBy: profile.Id,
+			Role:      req.Role,
+			MaxUses:   req.MaxUses,
+			CreatedAt: now,
+		}
+		if req.ExpiresInHours > 0 {
+			expiresAt := now.Add(time.Duration(req.ExpiresInHours) * time.Hour)
+			invite.ExpiresAt = &expiresAt
+		}
+		err = repository.CreateInvite(r.Context(), &invite)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(invite)
+	}
+}
+
+func ListInvitesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		if _, ok := authorizeChannel(w, r, profile, params["id"], models.RoleAdmin); !ok {
+			return
+		}
+		invites, err := repository.ListChannelInvites(r.Context(), params["id"])
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(invites)
+	}
+}
+
+func RevokeInviteHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		if _, ok := authorizeChannel(w, r, profile, params["id"], models.RoleAdmin); !ok {
+			return
+		}
+		err = repository.RevokeInvite(r.Context(), params["id"], params["inviteId"])
+		if err != nil {
+			responses.NotFound(w, "Invite not found")
+			return
+		}
+		responses.DeleteResponse(w, "Invite revoked")
+	}
+}
+
+// PreviewInviteHandler is public, it shows what the invite is for before
+// logging in or joining.
+func PreviewInviteHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		invite, channel, ok := usableInvite(w, r, params["code"])
+		if !ok {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(responses.InvitePreviewResponse{
+			Code:        invite.Code,
+			Name:        channel.Name,
+			Image:       channel.Image,
+			MemberCount: len(channel.Users),
+			ExpiresAt:   invite.ExpiresAt,
+		})
+	}
+}
+
+// RedeemInviteHandler adds the caller to the channel of the invite, members
+// get the channel back without using the invite.
+func RedeemInviteHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		invite, channel, ok := usableInvite(w, r, params["code"])
+		if !ok {
+			return
+		}
+		if channel.RoleOf(profile.Id) != "" {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(channel)
+			return
+		}
+		if !requireVerified(w, s, profile, "Verify your email to join channels") {
+			return
+		}
+		// Another redeem may have taken the last use
+		invite, err = repository.UseInvite(r.Context(), invite.Code, time.Now())
+		if err != nil {
+			responses.NotFound(w, "Invite not found or expired")
+			return
+		}
+		channelId := invite.ChannelId.Hex()
+		channel, err = repository.AddUserToChannel(r.Context(), profile.Id.Hex(), channelId)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		if invite.Role != models.RoleMember {
+			channel, err = repository.SetChannelRole(r.Context(), channelId, profile.Id.Hex(), invite.Role)
+			if err != nil {
+				responses.InternalServerError(w, err.Error())
+				return
+			}
+		}
+		neededChannelsWs := []string{channelId}
+		var stallMessage = models.Event{
+			Type:    models.EventMemberAdded,
+			Payload: models.MemberPayload{Channel: *channel, Member: *profile},
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, neededChannelsWs)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(channel)
+	}
+}
+
+// usableInvite writes the error response and returns false when the code is
+// unknown, revoked, expired or used up, or its channel is archived or deleted.
+func usableInvite(w http.ResponseWriter, r *http.Request, code string) (*models.Invite, *models.Channel, bool) {
+	invite, err := repository.GetInviteByCode(r.Context(), code)
+	if err != nil || !invite.Usable(time.Now()) {
+		responses.NotFound(w, "Invite not found or expired")
+		return nil, nil, false
+	}
+	channel, err := repository.GetChannelById(r.Context(), invite.ChannelId.Hex())
+	if err != nil || channel.Archived() || channel.Deleted() {
+		responses.NotFound(w, "Invite not found or expired")
+		return nil, nil, false
+	}
+	return invite, channel, true
+}
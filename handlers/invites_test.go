@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+)
+
+func TestInvites(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob, carol, dave := ts.signup("Alice"), ts.signup("Bob"), ts.signup("Carol"), ts.signup("Dave")
+	channel := ts.createChannel(alice, "general")
+	invites := "/channel/" + channel.Id.Hex() + "/invites"
+
+	var invite models.Invite
+	ts.expect(http.StatusCreated, http.MethodPost, invites, alice.Token, map[string]interface{}{
+		"max_uses": 2,
+	}, &invite)
+	if invite.Role != models.RoleMember || invite.Code == "" {
+		t.Fatalf("got the invite %+v", invite)
+	}
+
+	// The preview is public and does not show the members
+	var preview responses.InvitePreviewResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/invite/"+invite.Code, "", nil, &preview)
+	if preview.Name != "general" || preview.MemberCount != 1 {
+		t.Fatalf("got the preview %+v", preview)
+	}
+	ts.expect(http.StatusNotFound, http.MethodGet, "/invite/not-a-code", "", nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodPost, "/channel/join/"+invite.Code, "", nil, nil)
+
+	var joined models.Channel
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel/join/"+invite.Code, bob.Token, nil, &joined)
+	if joined.RoleOf(bob.Id) != models.RoleMember {
+		t.Fatalf("bob joined with the role %q", joined.RoleOf(bob.Id))
+	}
+	// Members get the channel back without using the invite
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/join/"+invite.Code, bob.Token, nil, nil)
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel/join/"+invite.Code, carol.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodPost, "/channel/join/"+invite.Code, dave.Token, nil, nil)
+
+	// Only admins see and make invites, and only the owner invites admins
+	ts.expect(http.StatusForbidden, http.MethodGet, invites, bob.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, invites, bob.Token, map[string]interface{}{}, nil)
+	ts.expect(http.StatusOK, http.MethodPatch, "/channel/"+channel.Id.Hex()+"/role/"+bob.Id.Hex(), alice.Token, map[string]string{
+		"role": models.RoleAdmin,
+	}, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, invites, bob.Token, map[string]interface{}{
+		"role": models.RoleAdmin,
+	}, nil)
+
+	var second models.Invite
+	ts.expect(http.StatusCreated, http.MethodPost, invites, bob.Token, map[string]interface{}{}, &second)
+	var listed []models.Invite
+	ts.expect(http.StatusOK, http.MethodGet, invites, alice.Token, nil, &listed)
+	if len(listed) != 2 {
+		t.Fatalf("listed %d invites, want 2", len(listed))
+	}
+	ts.expect(http.StatusOK, http.MethodDelete, invites+"/"+second.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, "/invite/"+second.Code, "", nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodPost, "/channel/join/"+second.Code, dave.Token, nil, nil)
+}
+
+func TestAdminInvites(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	channel := ts.createChannel(alice, "general")
+	invites := "/channel/" + channel.Id.Hex() + "/invites"
+
+	for _, body := range []map[string]interface{}{
+		{"role": models.RoleOwner},
+		{"max_uses": -1},
+		{"expires_in_hours": -1},
+	} {
+		ts.expect(http.StatusBadRequest, http.MethodPost, invites, alice.Token, body, nil)
+	}
+	var invite models.Invite
+	ts.expect(http.StatusCreated, http.MethodPost, invites, alice.Token, map[string]interface{}{
+		"role":             models.RoleAdmin,
+		"expires_in_hours": 1,
+	}, &invite)
+	if invite.ExpiresAt == nil {
+		t.Fatal("the invite does not expire")
+	}
+	var joined models.Channel
+	ts.expect(http.StatusCreated, http.MethodPost, "/channel/join/"+invite.Code, bob.Token, nil, &joined)
+	if joined.RoleOf(bob.Id) != models.RoleAdmin {
+		t.Fatalf("bob joined with the role %q", joined.RoleOf(bob.Id))
+	}
+}
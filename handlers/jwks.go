@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+)
+
+// JWKSHandler publishes the public keys so other services can verify the
+// access tokens without the signing keys.
+func JWKSHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		document, err := s.Keys().JWKS()
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		// Verifiers should fetch the keys again when they see an unknown kid
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(auth.KeyReloadInterval.Seconds())))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(document)
+	}
+}
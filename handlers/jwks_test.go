@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/jwks"
+	"github.com/dg/acordia/server"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestJWKSVerifiesTheAccessTokens(t *testing.T) {
+	dir := t.TempDir()
+	key, err := auth.NewSigningKey(auth.AlgorithmRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.WriteSigningKey(dir, key); err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, server.Config{JWTKeysDir: dir})
+	alice := ts.signup("Alice")
+
+	var document jwks.Set
+	ts.expect(http.StatusOK, http.MethodGet, "/.well-known/jwks.json", "", nil, &document)
+	if len(document.Keys) != 1 || document.Keys[0].Kid != key.Id {
+		t.Fatalf("published the keys %+v, want %s", document.Keys, key.Id)
+	}
+	// Another service verifies the token with the published key alone
+	_, err = jwt.Parse(alice.Token, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != document.Keys[0].Kid {
+			return nil, auth.ErrInvalidToken
+		}
+		return document.Keys[0].PublicKey()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+)
+
+type loginKey struct {
+	key          string
+	freeFailures int
+}
+
+// loginKeys are the counters of failed logins the request is checked
+// against, one for the account and one for the address of the client.
+func loginKeys(r *http.Request, email string) []loginKey {
+	return []loginKey{
+		{key: "account:" + strings.ToLower(strings.TrimSpace(email)), freeFailures: auth.AccountFreeFailures},
+		{key: "ip:" + clientIP(r), freeFailures: auth.AddressFreeFailures},
+	}
+}
+
+// loginAllowed writes the error response and returns false when the account
+// or the address has to wait before trying again.
+func loginAllowed(w http.ResponseWriter, r *http.Request, email string) bool {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range loginKeys(r, email) {
+		attempts, err := repository.GetLoginAttempts(r.Context(), key.key, now)
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return false
+		}
+		if retry := auth.LoginRetryAfter(attempts, key.freeFailures, now); retry > wait {
+			wait = retry
+		}
+	}
+	if wait > 0 {
+		responses.TooManyRequests(w, wait, "Too many failed logins, try again later")
+		return false
+	}
+	return true
+}
+
+func loginFailed(r *http.Request, email string) {
+	now := time.Now()
+	for _, key := range loginKeys(r, email) {
+		if _, err := repository.AddLoginFailure(r.Context(), key.key, now, auth.LoginFailureWindow); err != nil {
+			log.Println("Error counting failed login:", err)
+		}
+	}
+}
+
+// loginSucceeded only clears the account, a valid login must not hide the
+// failures of other accounts from the same address.
+func loginSucceeded(r *http.Request, email string) {
+	if err := repository.ClearLoginAttempts(r.Context(), loginKeys(r, email)[0].key); err != nil {
+		log.Println("Error clearing failed logins:", err)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/server"
+)
+
+func TestLoginLockout(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	login := func(status int, email string, password string) {
+		t.Helper()
+		ts.expect(status, http.MethodPost, "/login", "", map[string]string{
+			"email":    email,
+			"password": password,
+		}, nil)
+	}
+	for i := 0; i < auth.AccountFreeFailures; i++ {
+		login(http.StatusUnauthorized, alice.Email, "not-the-password")
+	}
+	// The account waits even with the right password, the email is matched
+	// like the login does
+	login(http.StatusTooManyRequests, alice.Email, alice.Password)
+	login(http.StatusTooManyRequests, " ALICE@example.com", alice.Password)
+	// Other accounts from the same address can still log in
+	login(http.StatusOK, bob.Email, bob.Password)
+}
+
+func TestTwoFactorCodesCountAsFailedLogins(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	ts.enableTwoFactor(alice)
+	for i := 0; i < auth.AccountFreeFailures; i++ {
+		ts.expect(http.StatusUnauthorized, http.MethodPost, "/login/2fa", "", map[string]string{
+			"challenge": ts.loginChallenge(alice),
+			"code":      "000000",
+		}, nil)
+	}
+	// The right password does not clear the failures of the codes
+	ts.expect(http.StatusTooManyRequests, http.MethodPost, "/login", "", map[string]string{
+		"email":    alice.Email,
+		"password": alice.Password,
+	}, nil)
+}
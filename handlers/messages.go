@@ -0,0 +1,630 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/dg/acordia/websocket"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultMessagesLimit = 50
+	maxMessagesLimit     = 100
+	maxEmojiLength       = 64
+)
+
+type InsertMessageRequest struct {
+	Description string   `bson:"description" json:"description"`
+	Image       string   `bson:"image" json:"image"`
+	DesertRef   string   `bson:"desert_ref" json:"desert_ref"`
+	Mentions    []string `bson:"mentions" json:"mentions"`
+}
+
+// AddMessagesToChannelHandler is the route of the first clients, it answers
+// with the channel and its latest messages like when they were embedded.
+func AddMessagesToChannelHandler(s server.Server) http.HandlerFunc {
+	return postMessageHandler(s, true)
+}
+
+// CreateMessageHandler answers with the new message.
+func CreateMessageHandler(s server.Server) http.HandlerFunc {
+	return postMessageHandler(s, false)
+}
+
+func postMessageHandler(s server.Server, legacy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		w.Header().Set("Content-Type", "application/json")
+		var req = InsertMessageRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request")
+			return
+		}
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
+			return
+		}
+		insertMessage, err := createMessage(r.Context(), profile, params["id"], req, nil)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			responses.NotFound(w, "Channel not found")
+			return
+		}
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		neededChannelsWs := []string{params["id"]}
+		payload, err := messageCreatedPayload(r.Context(), insertMessage, legacy || s.Hub().HasLegacyClients(neededChannelsWs))
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		var stallMessage = models.Event{
+			Type:    models.EventMessageCreated,
+			Payload: payload,
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, neededChannelsWs)
+		w.WriteHeader(http.StatusCreated)
+		if legacy {
+			json.NewEncoder(w).Encode(payload.LegacyChannel)
+			return
+		}
+		json.NewEncoder(w).Encode(insertMessage)
+	}
+}
+
+// messageCreatedPayload adds the channel the legacy clients receive with
+// every new message, it is only loaded when one of them needs it.
+func messageCreatedPayload(ctx context.Context, message *models.ChannelMessage, legacy bool) (models.MessagePayload, error) {
+	payload := models.MessagePayload{Message: *message}
+	if !legacy {
+		return payload, nil
+	}
+	channel, err := repository.GetChannelById(ctx, message.ChannelId.Hex())
+	if err != nil {
+		return payload, err
+	}
+	// The last page, oldest first like the embedded array
+	messages, err := repository.ListMessages(ctx, channel.Id.Hex(), models.MessagePage{Limit: defaultMessagesLimit})
+	if err != nil {
+		return payload, err
+	}
+	payload.LegacyChannel = &models.LegacyChannel{Channel: *channel, Messages: messages}
+	return payload, nil
+}
+
+func ListMessagesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		if _, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember); !ok {
+			return
+		}
+		page, err := messagePageFromQuery(r)
+		if err != nil {
+			responses.BadRequest(w, err.Error())
+			return
+		}
+		writeMessagePage(w, r, profile, params["id"], page)
+	}
+}
+
+func AddReplyHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		var req = InsertMessageRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request")
+			return
+		}
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
+			return
+		}
+		parentId, err := primitive.ObjectIDFromHex(params["messageId"])
+		if err != nil {
+			responses.BadRequest(w, "Invalid message id")
+			return
+		}
+		reply, err := createMessage(r.Context(), profile, params["id"], req, &parentId)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			responses.NotFound(w, "Message not found")
+			return
+		}
+		if errors.Is(err, repository.ErrNestedReply) {
+			responses.BadRequest(w, err.Error())
+			return
+		}
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		parent, err := repository.GetMessageById(r.Context(), params["id"], params["messageId"])
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		parent.SummarizeReactions(primitive.NilObjectID)
+		var stallMessage = models.Event{
+			Type:    models.EventThreadReply,
+			Payload: models.ThreadReply{Reply: *reply, Parent: *parent},
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, messageChannelsWs(params["id"], reply))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func ListRepliesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		if _, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember); !ok {
+			return
+		}
+		page, err := messagePageFromQuery(r)
+		if err != nil {
+			responses.BadRequest(w, err.Error())
+			return
+		}
+		// Only the messages of the channel have threads, replies do not
+		parent, err := repository.GetMessageById(r.Context(), params["id"], params["messageId"])
+		if err != nil || parent.Parent != nil {
+			responses.NotFound(w, "Message not found")
+			return
+		}
+		page.Parent = parent.Id
+		writeMessagePage(w, r, profile, params["id"], page)
+	}
+}
+
+func writeMessagePage(w http.ResponseWriter, r *http.Request, profile *models.Profile, channelId string, page models.MessagePage) {
+	// Ask for one more message to know if there is another page
+	requested := page.Limit
+	page.Limit++
+	messages, err := repository.ListMessages(r.Context(), channelId, page)
+	if err != nil {
+		responses.InternalServerError(w, err.Error())
+		return
+	}
+	hasMore := len(messages) > requested
+	if hasMore {
+		// The extra message is the one furthest from the cursor
+		if !page.After.IsZero() && page.Before.IsZero() {
+			messages = messages[:requested]
+		} else {
+			messages = messages[1:]
+		}
+	}
+	for i := range messages {
+		messages[i].SummarizeReactions(profile.Id)
+	}
+	response := responses.MessagePageResponse{
+		Messages: messages,
+		HasMore:  hasMore,
+	}
+	if len(messages) > 0 {
+		response.Before = encodeCursor(messages[0].Id)
+		response.After = encodeCursor(messages[len(messages)-1].Id)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+type UpdateMessageRequest struct {
+	Description string `bson:"description" json:"description"`
+	Image       string `bson:"image" json:"image"`
+	DesertRef   string `bson:"desert_ref" json:"desert_ref"`
+}
+
+func UpdateMessageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		var req = UpdateMessageRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request")
+			return
+		}
+		if req.Description == "" && req.Image == "" && req.DesertRef == "" {
+			responses.BadRequest(w, "The message can not be empty")
+			return
+		}
+		message, ok := canModifyMessage(w, r, profile, params["id"], params["messageId"])
+		if !ok {
+			return
+		}
+		// Sending the same content again is not an edit
+		if unchangedMessage(message, req) {
+			message.SummarizeReactions(profile.Id)
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(message)
+			return
+		}
+		date, err := models.CurrentDate()
+		if err != nil {
+			responses.InternalServerError(w, "Error loading location")
+			return
+		}
+		data := models.UpdateMessage{
+			Description: req.Description,
+			Image:       req.Image,
+			DesertRef:   req.DesertRef,
+			EditedAt:    date,
+		}
+		updatedMessage, err := repository.UpdateMessage(r.Context(), params["id"], params["messageId"], data)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			responses.NotFound(w, "Message not found")
+			return
+		}
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		// Everybody gets the same counts, the caller also gets its own reactions
+		updatedMessage.SummarizeReactions(primitive.NilObjectID)
+		var stallMessage = models.Event{
+			Type:    models.EventMessageUpdated,
+			Payload: models.MessagePayload{Message: *updatedMessage},
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, messageChannelsWs(params["id"], updatedMessage))
+		updatedMessage.SummarizeReactions(profile.Id)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(updatedMessage)
+	}
+}
+
+func DeleteMessageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		if _, ok := canModifyMessage(w, r, profile, params["id"], params["messageId"]); !ok {
+			return
+		}
+		deletedMessage, err := repository.DeleteMessage(r.Context(), params["id"], params["messageId"])
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			responses.NotFound(w, "Message not found")
+			return
+		}
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		var stallMessage = models.Event{
+			Type:    models.EventMessageDeleted,
+			Payload: models.MessagePayload{Message: *deletedMessage},
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, messageChannelsWs(params["id"], deletedMessage))
+		// The channel shows the reply count of the parent
+		if deletedMessage.Parent != nil {
+			parent, err := repository.GetMessageById(r.Context(), params["id"], deletedMessage.Parent.Hex())
+			if err == nil {
+				parent.SummarizeReactions(primitive.NilObjectID)
+				s.Hub().Broadcast(models.Event{
+					Type:    models.EventMessageUpdated,
+					Payload: models.MessagePayload{Message: *parent},
+					User:    profile.Name,
+				}, []string{params["id"]})
+			}
+		}
+		responses.DeleteResponse(w, "Message deleted")
+	}
+}
+
+func AddReactionHandler(s server.Server) http.HandlerFunc {
+	return reactionHandler(s, true)
+}
+
+func RemoveReactionHandler(s server.Server) http.HandlerFunc {
+	return reactionHandler(s, false)
+}
+
+// Adding and removing are idempotent, the clients are only notified when the
+// reactions of the message actually changed.
+func reactionHandler(s server.Server, add bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		emoji := params["emoji"]
+		if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+			responses.BadRequest(w, "Invalid emoji")
+			return
+		}
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
+			return
+		}
+		var changed bool
+		if add {
+			changed, err = repository.AddReaction(r.Context(), params["id"], params["messageId"], profile.Id, emoji)
+		} else {
+			changed, err = repository.RemoveReaction(r.Context(), params["id"], params["messageId"], profile.Id, emoji)
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			responses.NotFound(w, "Message not found")
+			return
+		}
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		message, err := repository.GetMessageById(r.Context(), params["id"], params["messageId"])
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		delta := models.ReactionDelta{
+			ChannelId: message.ChannelId,
+			MessageId: message.Id,
+			Emoji:     emoji,
+			UserId:    profile.Id,
+			Added:     add,
+			Count:     message.ReactionCount(emoji),
+		}
+		if changed {
+			var stallMessage = models.Event{
+				Type:    models.EventReactionChanged,
+				Payload: delta,
+				User:    profile.Name,
+			}
+			s.Hub().Broadcast(stallMessage, messageChannelsWs(params["id"], message))
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(delta)
+	}
+}
+
+// canModifyMessage writes the error response and returns false when the
+// message does not exist, the channel is archived or the caller is neither
+// its author nor a channel admin.
+func canModifyMessage(w http.ResponseWriter, r *http.Request, profile *models.Profile, channelId string, messageId string) (*models.ChannelMessage, bool) {
+	channel, ok := authorizeChannel(w, r, profile, channelId, models.RoleMember)
+	if !ok || !writableChannel(w, channel) {
+		return nil, false
+	}
+	message, err := repository.GetMessageById(r.Context(), channelId, messageId)
+	if err != nil {
+		responses.NotFound(w, "Message not found")
+		return nil, false
+	}
+	if message.Deleted {
+		responses.NotFound(w, "Message not found")
+		return nil, false
+	}
+	if message.User.Id != profile.Id && !channel.HasRole(profile.Id, models.RoleAdmin) {
+		responses.Forbidden(w, "Only the author or a channel admin can modify this message")
+		return nil, false
+	}
+	return message, true
+}
+
+// unchangedMessage reports if the edit keeps every field as it is, empty
+// fields are not changed.
+func unchangedMessage(message *models.ChannelMessage, req UpdateMessageRequest) bool {
+	return (req.Description == "" || req.Description == message.Description) &&
+		(req.Image == "" || req.Image == message.Image) &&
+		(req.DesertRef == "" || req.DesertRef == message.DesertRef)
+}
+
+// createMessage is the path every new message goes through, from the http
+// handlers or from the websocket.
+func createMessage(ctx context.Context, profile *models.Profile, channelId string, req InsertMessageRequest, parent *primitive.ObjectID) (*models.ChannelMessage, error) {
+	date, err := models.CurrentDate()
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := channelMentions(ctx, channelId, req.Mentions)
+	if err != nil {
+		return nil, err
+	}
+	message := models.ChannelMessage{
+		Parent:      parent,
+		User:        *profile,
+		Date:        date,
+		Description: req.Description,
+		Image:       req.Image,
+		DesertRef:   req.DesertRef,
+		Mentions:    mentions,
+	}
+	return repository.AddMessagesToChannel(ctx, &message, channelId)
+}
+
+// SocketMessagePoster lets the hub store the messages posted through the
+// websocket like AddMessagesToChannelHandler and AddReplyHandler do.
+func SocketMessagePoster(s server.Server) websocket.MessagePoster {
+	return func(ctx context.Context, profile *models.Profile, channelId string, parentId string, payload models.PostMessagePayload) (*websocket.PostedMessage, error) {
+		req := InsertMessageRequest{
+			Description: payload.Description,
+			Image:       payload.Image,
+			DesertRef:   payload.DesertRef,
+			Mentions:    payload.Mentions,
+		}
+		channel, err := repository.GetChannelById(ctx, channelId)
+		if err != nil || channel.Deleted() {
+			return nil, errors.New("Channel not found")
+		}
+		if channel.RoleOf(profile.Id) == "" {
+			return nil, errors.New("You are not a member of this channel")
+		}
+		if channel.Archived() {
+			return nil, errors.New("The channel is archived")
+		}
+		var parent *primitive.ObjectID
+		if parentId != "" {
+			oid, err := primitive.ObjectIDFromHex(parentId)
+			if err != nil {
+				return nil, errors.New("Message not found")
+			}
+			parent = &oid
+		}
+		message, err := createMessage(ctx, profile, channelId, req, parent)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if parent != nil {
+				return nil, errors.New("Message not found")
+			}
+			return nil, errors.New("Channel not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			created, err := messageCreatedPayload(ctx, message, s.Hub().HasLegacyClients([]string{channelId}))
+			if err != nil {
+				return nil, err
+			}
+			return &websocket.PostedMessage{
+				Message:  *message,
+				Event:    models.Event{Type: models.EventMessageCreated, Payload: created, User: profile.Name},
+				Channels: []string{channelId},
+			}, nil
+		}
+		parentMessage, err := repository.GetMessageById(ctx, channelId, parentId)
+		if err != nil {
+			return nil, err
+		}
+		parentMessage.SummarizeReactions(primitive.NilObjectID)
+		return &websocket.PostedMessage{
+			Message:  *message,
+			Event:    models.Event{Type: models.EventThreadReply, Payload: models.ThreadReply{Reply: *message, Parent: *parentMessage}, User: profile.Name},
+			Channels: messageChannelsWs(channelId, message),
+		}, nil
+	}
+}
+
+// channelMentions keeps the mentioned users that are members of the channel,
+// unknown ids are ignored.
+func channelMentions(ctx context.Context, channelId string, ids []string) ([]primitive.ObjectID, error) {
+	channel, err := repository.GetChannelById(ctx, channelId)
+	if err != nil {
+		return nil, err
+	}
+	var mentions []primitive.ObjectID
+	for _, id := range ids {
+		for _, user := range channel.Users {
+			if user.Id.Hex() == id {
+				mentions = append(mentions, user.Id)
+				break
+			}
+		}
+	}
+	return mentions, nil
+}
+
+// messageChannelsWs returns the websocket channels interested in a message,
+// replies are also sent to the clients following the thread.
+func messageChannelsWs(channelId string, message *models.ChannelMessage) []string {
+	channels := []string{channelId}
+	if message.Parent != nil {
+		channels = append(channels, websocket.ThreadChannel(channelId, message.Parent.Hex()))
+	}
+	return channels
+}
+
+func messagePageFromQuery(r *http.Request) (models.MessagePage, error) {
+	query := r.URL.Query()
+	page := models.MessagePage{Limit: defaultMessagesLimit}
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return page, errors.New("Invalid limit")
+		}
+		if value > maxMessagesLimit {
+			value = maxMessagesLimit
+		}
+		page.Limit = value
+	}
+	var err error
+	if before := query.Get("before"); before != "" {
+		if page.Before, err = decodeCursor(before); err != nil {
+			return page, errors.New("Invalid before cursor")
+		}
+	}
+	if after := query.Get("after"); after != "" {
+		if page.After, err = decodeCursor(after); err != nil {
+			return page, errors.New("Invalid after cursor")
+		}
+	}
+	return page, nil
+}
+
+// Cursors are opaque to clients, they only carry the id of a message.
+func encodeCursor(id primitive.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString(id[:])
+}
+
+func decodeCursor(cursor string) (primitive.ObjectID, error) {
+	var id primitive.ObjectID
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return id, err
+	}
+	if len(raw) != len(id) {
+		return id, errors.New("invalid cursor")
+	}
+	copy(id[:], raw)
+	return id, nil
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLegacyClientsGetTheChannelWithNewMessages(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	channel := ts.createChannel(alice, "general")
+	ts.addMember(alice, channel, bob)
+	id := channel.Id.Hex()
+	hasLegacyClients := func() bool {
+		return ts.broker.Hub().HasLegacyClients([]string{id})
+	}
+
+	current := ts.dial(bob, id, "acordia.v2")
+	ts.readFrame(current, func(frame testFrame) bool { return frame.Type == models.EventHello })
+	if hasLegacyClients() {
+		t.Fatal("a client of the current protocol is a legacy one")
+	}
+	first := ts.postMessage(alice, channel, "hello")
+	frame := ts.readFrame(current, func(frame testFrame) bool { return frame.Type == models.EventMessageCreated })
+	var created models.MessagePayload
+	if err := json.Unmarshal(frame.Payload, &created); err != nil || created.Message.Id != first.Id {
+		t.Fatalf("got the payload %s, %v", frame.Payload, err)
+	}
+
+	legacy := ts.dial(alice, id)
+	ts.waitFor("the legacy client", hasLegacyClients)
+	second := ts.postMessage(bob, channel, "hi alice")
+	frame = ts.readFrame(legacy, func(frame testFrame) bool { return frame.Code == "2" })
+	var embedded models.LegacyChannel
+	if err := json.Unmarshal(frame.Payload, &embedded); err != nil {
+		t.Fatal(err)
+	}
+	if embedded.Id != channel.Id || len(embedded.Messages) != 2 || embedded.Messages[1].Id != second.Id {
+		t.Fatalf("got the legacy payload %s", frame.Payload)
+	}
+
+	// The route of the first clients answers with the channel without them
+	legacy.Close()
+	ts.waitFor("the legacy client to leave", func() bool { return !hasLegacyClients() })
+	ts.expect(http.StatusCreated, http.MethodPatch, "/channel/event/addMessage/"+id, alice.Token, map[string]string{
+		"description": "again",
+	}, &embedded)
+	if len(embedded.Messages) != 3 {
+		t.Fatalf("the answer has %d messages, want 3", len(embedded.Messages))
+	}
+}
+
+func TestListRepliesOfUnknownMessages(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	general, random := ts.createChannel(alice, "general"), ts.createChannel(alice, "random")
+	message := ts.postMessage(alice, general, "hello")
+	other := ts.postMessage(alice, random, "hi")
+	replies := func(channel models.Channel, messageId string) string {
+		return "/channel/" + channel.Id.Hex() + "/message/" + messageId + "/replies"
+	}
+	var reply models.ChannelMessage
+	ts.expect(http.StatusCreated, http.MethodPost, replies(general, message.Id.Hex()), alice.Token, map[string]string{
+		"description": "a reply",
+	}, &reply)
+
+	var page responses.MessagePageResponse
+	ts.expect(http.StatusOK, http.MethodGet, replies(general, message.Id.Hex()), alice.Token, nil, &page)
+	if len(page.Messages) != 1 || page.Messages[0].Id != reply.Id {
+		t.Fatalf("got the replies %+v", page.Messages)
+	}
+	ts.expect(http.StatusNotFound, http.MethodGet, replies(general, "not-an-id"), alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, replies(general, primitive.NewObjectID().Hex()), alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, replies(general, other.Id.Hex()), alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodGet, replies(general, reply.Id.Hex()), alice.Token, nil, nil)
+}
+
+func TestCursor(t *testing.T) {
+	id := primitive.NewObjectID()
+	got, err := decodeCursor(encodeCursor(id))
+	if err != nil || got != id {
+		t.Fatalf("decodeCursor(encodeCursor(%s)) = %s, %v", id.Hex(), got.Hex(), err)
+	}
+	for _, cursor := range []string{"not a cursor", encodeCursor(id)[:8], id.Hex()} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) did not fail", cursor)
+		}
+	}
+}
+
+func TestListMessagesPages(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	channel := ts.createChannel(alice, "general")
+	var posted []models.ChannelMessage
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		posted = append(posted, ts.postMessage(alice, channel, text))
+	}
+	list := func(query string) responses.MessagePageResponse {
+		t.Helper()
+		var page responses.MessagePageResponse
+		ts.expect(http.StatusOK, http.MethodGet, "/channel/"+channel.Id.Hex()+"/messages"+query, alice.Token, nil, &page)
+		return page
+	}
+	ids := func(page responses.MessagePageResponse) []primitive.ObjectID {
+		var ids []primitive.ObjectID
+		for _, message := range page.Messages {
+			ids = append(ids, message.Id)
+		}
+		return ids
+	}
+	expectPage := func(page responses.MessagePageResponse, hasMore bool, want ...models.ChannelMessage) {
+		t.Helper()
+		got := ids(page)
+		if len(got) != len(want) || page.HasMore != hasMore {
+			t.Fatalf("got %d messages and has_more %v, want %d and %v", len(got), page.HasMore, len(want), hasMore)
+		}
+		for i := range want {
+			if got[i] != want[i].Id {
+				t.Fatalf("message %d is %s, want %s", i, got[i].Hex(), want[i].Id.Hex())
+			}
+		}
+	}
+
+	// The latest page comes first, oldest message first in it
+	latest := list("?limit=2")
+	expectPage(latest, true, posted[3], posted[4])
+	older := list("?limit=2&before=" + latest.Before)
+	expectPage(older, true, posted[1], posted[2])
+	expectPage(list("?limit=2&before="+older.Before), false, posted[0])
+	expectPage(list("?limit=2&after="+older.Before), true, posted[2], posted[3])
+	expectPage(list("?after="+latest.Before), false, posted[4])
+	expectPage(list(""), false, posted...)
+
+	for _, query := range []string{"?limit=0", "?limit=many", "?before=nope", "?after=" + posted[0].Id.Hex()} {
+		ts.expect(http.StatusBadRequest, http.MethodGet, "/channel/"+channel.Id.Hex()+"/messages"+query, alice.Token, nil, nil)
+	}
+}
+
+func TestEditAndDeleteMessages(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob, carol := ts.signup("Alice"), ts.signup("Bob"), ts.signup("Carol")
+	channel := ts.createChannel(alice, "general")
+	ts.addMember(alice, channel, bob)
+	ts.addMember(alice, channel, carol)
+	socket := ts.dial(bob, channel.Id.Hex(), "acordia.v2")
+	ts.readFrame(socket, func(frame testFrame) bool { return frame.Type == models.EventHello })
+	message := ts.postMessage(bob, channel, "helo")
+	path := "/channel/" + channel.Id.Hex() + "/message/" + message.Id.Hex()
+
+	ts.expect(http.StatusBadRequest, http.MethodPatch, path, bob.Token, map[string]string{}, nil)
+	// Only the author and the admins change the message
+	ts.expect(http.StatusForbidden, http.MethodPatch, path, carol.Token, map[string]string{"description": "hi"}, nil)
+	ts.expect(http.StatusForbidden, http.MethodDelete, path, carol.Token, nil, nil)
+	var unchanged models.ChannelMessage
+	ts.expect(http.StatusOK, http.MethodPatch, path, bob.Token, map[string]string{"description": "helo"}, &unchanged)
+	if unchanged.EditedAt != "" {
+		t.Fatal("sending the same text marked the message as edited")
+	}
+	var edited models.ChannelMessage
+	ts.expect(http.StatusOK, http.MethodPatch, path, bob.Token, map[string]string{"description": "hello"}, &edited)
+	if edited.Description != "hello" || edited.EditedAt == "" {
+		t.Fatalf("got the edited message %+v", edited)
+	}
+	frame := ts.readFrame(socket, func(frame testFrame) bool { return frame.Type == models.EventMessageUpdated })
+	var updated models.MessagePayload
+	if err := json.Unmarshal(frame.Payload, &updated); err != nil || updated.Message.Description != "hello" {
+		t.Fatalf("got the payload %s, %v", frame.Payload, err)
+	}
+
+	ts.expect(http.StatusOK, http.MethodDelete, path, alice.Token, nil, nil)
+	ts.readFrame(socket, func(frame testFrame) bool { return frame.Type == models.EventMessageDeleted })
+	ts.expect(http.StatusNotFound, http.MethodDelete, path, bob.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodPatch, path, bob.Token, map[string]string{"description": "back"}, nil)
+	var page responses.MessagePageResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/channel/"+channel.Id.Hex()+"/messages", bob.Token, nil, &page)
+	if len(page.Messages) != 1 || !page.Messages[0].Deleted || page.Messages[0].Description != "" {
+		t.Fatalf("the deleted message is listed as %+v", page.Messages)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	channel := ts.createChannel(alice, "general")
+	ts.addMember(alice, channel, bob)
+	message := ts.postMessage(alice, channel, "hello")
+	reaction := "/channel/" + channel.Id.Hex() + "/message/" + message.Id.Hex() + "/reactions/"
+	react := func(user *testUser, method string, emoji string) models.ReactionDelta {
+		t.Helper()
+		var delta models.ReactionDelta
+		ts.expect(http.StatusOK, method, reaction+emoji, user.Token, nil, &delta)
+		return delta
+	}
+
+	// Reacting twice with the same emoji is counted once
+	react(alice, http.MethodPut, "👍")
+	if delta := react(alice, http.MethodPut, "👍"); delta.Count != 1 || !delta.Added {
+		t.Fatalf("got the delta %+v", delta)
+	}
+	if delta := react(bob, http.MethodPut, "👍"); delta.Count != 2 {
+		t.Fatalf("got the count %d, want 2", delta.Count)
+	}
+	react(bob, http.MethodPut, "🎉")
+	if delta := react(bob, http.MethodDelete, "🎉"); delta.Count != 0 || delta.Added {
+		t.Fatalf("got the delta %+v", delta)
+	}
+
+	var page responses.MessagePageResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/channel/"+channel.Id.Hex()+"/messages", alice.Token, nil, &page)
+	reactions := page.Messages[0].Reactions
+	if len(reactions) != 1 || reactions[0].Emoji != "👍" || reactions[0].Count != 2 || !reactions[0].Me {
+		t.Fatalf("alice sees the reactions %+v", reactions)
+	}
+
+	ts.expect(http.StatusBadRequest, http.MethodPut, reaction+strings.Repeat("a", 100), alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodPut, "/channel/"+channel.Id.Hex()+"/message/"+primitive.NewObjectID().Hex()+"/reactions/👍", alice.Token, nil, nil)
+}
+
+func TestThreadReplies(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	channel := ts.createChannel(alice, "general")
+	ts.addMember(alice, channel, bob)
+	message := ts.postMessage(alice, channel, "hello")
+	replies := "/channel/" + channel.Id.Hex() + "/message/" + message.Id.Hex() + "/replies"
+	thread := ts.dial(alice, channel.Id.Hex()+":"+message.Id.Hex(), "acordia.v2")
+	ts.readFrame(thread, func(frame testFrame) bool { return frame.Type == models.EventHello })
+
+	var reply models.ChannelMessage
+	ts.expect(http.StatusCreated, http.MethodPost, replies, bob.Token, map[string]string{"description": "hi"}, &reply)
+	if reply.Parent == nil || *reply.Parent != message.Id {
+		t.Fatalf("the reply has the parent %v", reply.Parent)
+	}
+	frame := ts.readFrame(thread, func(frame testFrame) bool { return frame.Type == models.EventThreadReply })
+	var payload models.ThreadReply
+	if err := json.Unmarshal(frame.Payload, &payload); err != nil || payload.Reply.Id != reply.Id || payload.Parent.ReplyCount != 1 {
+		t.Fatalf("got the payload %s, %v", frame.Payload, err)
+	}
+	// Threads have one level and replies are not in the channel
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/channel/"+channel.Id.Hex()+"/message/"+reply.Id.Hex()+"/replies", alice.Token, map[string]string{
+		"description": "nested",
+	}, nil)
+	var page responses.MessagePageResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/channel/"+channel.Id.Hex()+"/messages", alice.Token, nil, &page)
+	if len(page.Messages) != 1 || page.Messages[0].ReplyCount != 1 || page.Messages[0].LastReplyAt != reply.Date {
+		t.Fatalf("the channel lists %+v", page.Messages)
+	}
+
+	// Deleting the reply updates the thread of the parent
+	ts.expect(http.StatusOK, http.MethodDelete, "/channel/"+channel.Id.Hex()+"/message/"+reply.Id.Hex(), bob.Token, nil, nil)
+	var after responses.MessagePageResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/channel/"+channel.Id.Hex()+"/messages", alice.Token, nil, &after)
+	if after.Messages[0].ReplyCount != 0 || after.Messages[0].LastReplyAt != "" {
+		t.Fatalf("the parent is %+v after deleting its reply", after.Messages[0])
+	}
+	// Deleted messages can not be answered
+	ts.expect(http.StatusOK, http.MethodDelete, "/channel/"+channel.Id.Hex()+"/message/"+message.Id.Hex(), alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodPost, replies, bob.Token, map[string]string{"description": "late"}, nil)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Time the user has to log in on the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// OIDCLoginHandler sends the browser to the provider, the state, nonce and
+// PKCE verifier are kept until the callback.
+func OIDCLoginHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		provider := s.OIDC()
+		if provider == nil {
+			responses.NotFound(w, "Single sign on is not configured")
+			return
+		}
+		var secrets [3]string
+		for i := range secrets {
+			secret, err := auth.RandomToken(32)
+			if err != nil {
+				responses.InternalServerError(w, "Internal Server Error")
+				return
+			}
+			secrets[i] = secret
+		}
+		state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+		err := repository.CreateOIDCLogin(r.Context(), &models.OIDCLogin{
+			StateHash:  auth.HashToken(state),
+			Nonce:      nonce,
+			Verifier:   verifier,
+			DeviceName: r.URL.Query().Get("device_name"),
+			ExpiresAt:  time.Now().Add(oidcLoginTTL),
+		})
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		url, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusBadGateway, "The single sign on provider is not available")
+			return
+		}
+		http.Redirect(w, r, url, http.StatusFound)
+	}
+}
+
+// OIDCCallbackHandler finishes the login on the provider and logs in the
+// user linked to it like LoginHandler does.
+func OIDCCallbackHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		provider := s.OIDC()
+		if provider == nil {
+			responses.NotFound(w, "Single sign on is not configured")
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("error") != "" {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "The single sign on login failed: "+query.Get("error"))
+			return
+		}
+		login, err := repository.UseOIDCLogin(r.Context(), auth.HashToken(query.Get("state")), time.Now())
+		if err != nil {
+			responses.BadRequest(w, "Invalid or expired login")
+			return
+		}
+		claims, err := provider.Exchange(r.Context(), query.Get("code"), login.Verifier, login.Nonce)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Could not verify the single sign on login")
+			return
+		}
+		user, ok := oidcUser(w, r, s, claims.Issuer+"#"+claims.Subject, claims.Email, claims.EmailVerified, claims.Name)
+		if !ok {
+			return
+		}
+		if user.TwoFactorEnabled() {
+			challenge, err := newLoginChallenge(r, user)
+			if err != nil {
+				responses.InternalServerError(w, "Internal Server Error")
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(challenge)
+			return
+		}
+		session, err := startSession(r, s, user, login.DeviceName)
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		json.NewEncoder(w).Encode(session)
+	}
+}
+
+// oidcUser returns the user linked to the subject, the first login links the
+// account with the same email or creates a new one. Only emails verified by
+// the provider are trusted, and only accounts that verified the email are
+// linked: anyone can sign up with an address they do not own.
+func oidcUser(w http.ResponseWriter, r *http.Request, s server.Server, subject string, email string, verified bool, name string) (*models.User, bool) {
+	user, err := repository.GetUserByOIDCSubject(r.Context(), subject)
+	if err == nil {
+		return user, true
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		responses.InternalServerError(w, err.Error())
+		return nil, false
+	}
+	if email == "" || !verified {
+		responses.Forbidden(w, "The single sign on provider did not verify the email")
+		return nil, false
+	}
+	email = canonicalEmail(email)
+	user, err = repository.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if name == "" {
+			name = email
+		}
+		// Without a password the account can only log in with the provider
+		// until the user resets it
+		profile, err := repository.InsertUser(r.Context(), &models.InsertUser{
+			Name:        name,
+			Email:       email,
+			OIDCSubject: subject,
+		})
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			responses.Conflict(w, "The email is already registered")
+			return nil, false
+		}
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return nil, false
+		}
+		user, err = repository.GetUserAccountById(r.Context(), profile.Id.Hex())
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return nil, false
+		}
+		return user, true
+	}
+	if err != nil {
+		responses.InternalServerError(w, err.Error())
+		return nil, false
+	}
+	if user.OIDCSubject != "" {
+		responses.Forbidden(w, "The account is linked to another single sign on user")
+		return nil, false
+	}
+	if user.Unverified {
+		responses.Forbidden(w, "Verify the email of the existing account, or reset its password, before signing in with single sign on")
+		return nil, false
+	}
+	if err := repository.SetUserOIDCSubject(r.Context(), user.Id, subject); err != nil {
+		responses.InternalServerError(w, err.Error())
+		return nil, false
+	}
+	// The password keeps working, the sessions opened before the link are
+	// closed and the login of the provider starts a new one
+	if err := repository.RevokeUserSessions(r.Context(), user.Id, primitive.NilObjectID); err != nil {
+		responses.InternalServerError(w, err.Error())
+		return nil, false
+	}
+	s.Hub().CloseUserSessions(user.Id.Hex(), "")
+	recordAudit(r, user.Id, models.AuditOIDCLinked)
+	user.OIDCSubject = subject
+	return user, true
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/oidc"
+	"github.com/dg/acordia/oidc/oidctest"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+)
+
+// newOIDCTestServer serves the handlers with single sign on on the mock
+// provider, the user of the provider is who logs in.
+func newOIDCTestServer(t *testing.T) (*testServer, *oidctest.Provider) {
+	t.Helper()
+	provider, err := oidctest.NewProvider("", oidctest.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := httptest.NewServer(provider.Handler())
+	t.Cleanup(idp.Close)
+	provider.Issuer = idp.URL
+	ts := newTestServer(t, server.Config{
+		OIDC: oidc.Config{Issuer: idp.URL, ClientId: "acordia"},
+	})
+	return ts, provider
+}
+
+// oidcLogin follows the redirects of the login through the provider and
+// returns the status of the callback.
+func (ts *testServer) oidcLogin(out interface{}) int {
+	ts.t.Helper()
+	res, err := http.Get(ts.url + "/oidc/login")
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Request.URL.Path != "/oidc/callback" {
+		ts.t.Fatalf("the login ended on %s", res.Request.URL)
+	}
+	if out != nil && res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestOIDCLoginCreatesTheAccount(t *testing.T) {
+	ts, provider := newOIDCTestServer(t)
+	provider.User = oidctest.User{Subject: "alice", Email: "Alice@Example.com", EmailVerified: true, Name: "Alice"}
+
+	var login responses.LoginResponse
+	if status := ts.oidcLogin(&login); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	var profile models.Profile
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", login.Token, nil, &profile)
+	if profile.Email != "alice@example.com" || profile.Name != "Alice" {
+		t.Fatalf("got the profile %+v", profile)
+	}
+
+	// The subject finds the same account again
+	var again responses.LoginResponse
+	if status := ts.oidcLogin(&again); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	var second models.Profile
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", again.Token, nil, &second)
+	if second.Id != profile.Id {
+		t.Fatalf("the second login is the account %s, want %s", second.Id.Hex(), profile.Id.Hex())
+	}
+
+	// Emails the provider did not verify are not trusted
+	provider.User = oidctest.User{Subject: "bob", Email: "bob@example.com", Name: "Bob"}
+	if status := ts.oidcLogin(nil); status != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestOIDCLinksOnlyVerifiedAccounts(t *testing.T) {
+	ts, provider := newOIDCTestServer(t)
+	alice := ts.signup("Alice")
+	provider.User = oidctest.User{Subject: "alice", Email: alice.Email, EmailVerified: true, Name: "Alice"}
+
+	// Anyone can sign up with the address, it is not linked before the
+	// owner of the account verifies it
+	if status := ts.oidcLogin(nil); status != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", status, http.StatusForbidden)
+	}
+	ts.expect(http.StatusOK, http.MethodPost, "/email/confirm", "", map[string]string{
+		"token": ts.mailCode(alice.Email),
+	}, nil)
+
+	var login responses.LoginResponse
+	if status := ts.oidcLogin(&login); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	var profile models.Profile
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", login.Token, nil, &profile)
+	if profile.Id != alice.Id {
+		t.Fatalf("linked the account %s, want %s", profile.Id.Hex(), alice.Id.Hex())
+	}
+	// The sessions from before the link are closed, the password still works
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", alice.Token, nil, nil)
+	ts.login(alice.Email, alice.Password)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/mailer"
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything after 72 bytes
+	maxPasswordLength = 72
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ForgotPasswordHandler mails a reset token to the user, the answer is the
+// same whether the email exists or not.
+func ForgotPasswordHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req = ForgotPasswordRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Email == "" {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		user, err := repository.GetUserByEmail(r.Context(), canonicalEmail(req.Email))
+		if err == nil {
+			err = sendPasswordReset(r, s, user)
+			if err != nil {
+				log.Println("Error sending password reset:", err)
+			}
+		}
+		responses.Accepted(w, "If the email is registered you will receive a reset code")
+	}
+}
+
+func sendPasswordReset(r *http.Request, s server.Server, user *models.User) error {
+	token, record, err := auth.NewUserToken(user.Id, models.TokenPasswordReset, auth.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	record.Email = user.Email
+	if err := repository.CreateUserToken(r.Context(), record); err != nil {
+		return err
+	}
+	return s.Mailer().Send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Acordia password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this code to choose a new password: %s\n\nIt expires in %d minutes, if you did not ask for it you can ignore this mail.",
+			user.Name, token, int(auth.PasswordResetTTL.Minutes())),
+	})
+}
+
+// ResetPasswordHandler sets the new password and closes every session of the
+// user, the token can only be used once.
+func ResetPasswordHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req = ResetPasswordRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		if err := validatePassword(req.Password); err != nil {
+			responses.BadRequest(w, err.Error())
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		token, err := repository.UseUserToken(r.Context(), models.TokenPasswordReset, auth.HashToken(req.Token), time.Now())
+		if err != nil {
+			responses.BadRequest(w, "Invalid or expired reset code")
+			return
+		}
+		err = repository.SetUserPassword(r.Context(), token.UserId, string(hashedPassword))
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		// The code was mailed to the address, so the user owns it. This is how
+		// an account someone else signed up with is claimed.
+		user, err := repository.GetUserById(r.Context(), token.UserId.Hex())
+		if err == nil && token.Email != "" && token.Email == user.Email {
+			err = repository.SetUserVerified(r.Context(), token.UserId, true)
+			if err != nil {
+				responses.InternalServerError(w, err.Error())
+				return
+			}
+		}
+		err = repository.RevokeUserSessions(r.Context(), token.UserId, primitive.NilObjectID)
+		if err != nil {
+			responses.InternalServerError(w, "Error closing sessions")
+			return
+		}
+		s.Hub().CloseUserSessions(token.UserId.Hex(), "")
+		recordAudit(r, token.UserId, models.AuditPasswordReset)
+		responses.DeleteResponse(w, "Password updated, log in again")
+	}
+}
+
+// ChangePasswordHandler keeps the session of the caller open and closes all
+// the other ones.
+func ChangePasswordHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		claims, err := middleware.TokenClaims(s, r)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Error validating token")
+			return
+		}
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		var req = ChangePasswordRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		user, err := repository.GetUserAccountById(r.Context(), profile.Id.Hex())
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "The current password is not correct")
+			return
+		}
+		if err := validatePassword(req.NewPassword); err != nil {
+			responses.BadRequest(w, err.Error())
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		err = repository.SetUserPassword(r.Context(), user.Id, string(hashedPassword))
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		err = repository.RevokeUserSessions(r.Context(), user.Id, claims.SessionId)
+		if err != nil {
+			responses.InternalServerError(w, "Error closing sessions")
+			return
+		}
+		s.Hub().CloseUserSessions(user.Id.Hex(), claims.SessionId.Hex())
+		recordAudit(r, user.Id, models.AuditPasswordChanged)
+		responses.DeleteResponse(w, "Password updated, the other sessions were closed")
+	}
+}
+
+// validatePassword is the policy for every new password.
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("The password must have at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("The password can not have more than %d characters", maxPasswordLength)
+	}
+	return nil
+}
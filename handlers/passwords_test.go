@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/mailer"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/server"
+)
+
+func TestChangePassword(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	other := ts.login(alice.Email, alice.Password)
+
+	ts.expect(http.StatusUnauthorized, http.MethodPost, "/user/password", alice.Token, map[string]string{
+		"current_password": "not-the-password",
+		"new_password":     "another-long-password",
+	}, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/user/password", alice.Token, map[string]string{
+		"current_password": alice.Password,
+		"new_password":     "short",
+	}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/user/password", alice.Token, map[string]string{
+		"current_password": alice.Password,
+		"new_password":     "another-long-password",
+	}, nil)
+
+	// The session of the caller stays open, the other ones are closed
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", alice.Token, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", other.Token, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodPost, "/login", "", map[string]string{
+		"email":    alice.Email,
+		"password": alice.Password,
+	}, nil)
+	ts.login(alice.Email, "another-long-password")
+}
+
+func TestResetPassword(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	forgot := func(email string) {
+		t.Helper()
+		ts.expect(http.StatusAccepted, http.MethodPost, "/password/forgot", "", map[string]string{"email": email}, nil)
+	}
+	reset := func(status int, code string, password string) {
+		t.Helper()
+		ts.expect(status, http.MethodPost, "/password/reset", "", map[string]string{
+			"token":    code,
+			"password": password,
+		}, nil)
+	}
+
+	// Unknown emails get the same answer and no mail
+	forgot("nobody@example.com")
+	if messages := ts.broker.Mailer().(*mailer.MemoryMailer).Messages("nobody@example.com"); len(messages) != 0 {
+		t.Fatal("a reset code was mailed to an unknown address")
+	}
+	forgot("ALICE@example.com")
+	code := ts.mailCode(alice.Email)
+	reset(http.StatusBadRequest, code, "short")
+	reset(http.StatusBadRequest, "not-the-code", "another-long-password")
+	reset(http.StatusOK, code, "another-long-password")
+	reset(http.StatusBadRequest, code, "a-third-long-password")
+
+	// Every session is closed and the mailed address is verified
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", alice.Token, nil, nil)
+	login := ts.login(alice.Email, "another-long-password")
+	var profile models.Profile
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", login.Token, nil, &profile)
+	if profile.Unverified {
+		t.Fatal("the reset did not verify the email")
+	}
+}
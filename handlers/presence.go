@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/dg/acordia/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxPresenceUsers = 100
+
+type UpdatePresenceRequest struct {
+	Status string `json:"status"`
+}
+
+func PresenceHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		_, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		ids := []primitive.ObjectID{}
+		for _, id := range strings.Split(r.URL.Query().Get("users"), ",") {
+			if id == "" {
+				continue
+			}
+			oid, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				responses.BadRequest(w, "Invalid user id")
+				return
+			}
+			ids = append(ids, oid)
+		}
+		if len(ids) > maxPresenceUsers {
+			responses.BadRequest(w, "Too many users")
+			return
+		}
+		presences, err := s.Hub().Presence(r.Context(), ids)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(presences)
+	}
+}
+
+func UpdatePresenceHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		var req = UpdatePresenceRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request")
+			return
+		}
+		presence, err := s.Hub().SetStatus(profile.Id, req.Status)
+		if errors.Is(err, websocket.ErrInvalidStatus) {
+			responses.BadRequest(w, err.Error())
+			return
+		}
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(presence)
+	}
+}
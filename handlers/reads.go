@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func MarkReadHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		if _, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember); !ok {
+			return
+		}
+		date, err := models.CurrentDate()
+		if err != nil {
+			responses.InternalServerError(w, "Error loading location")
+			return
+		}
+		state, advanced, err := repository.MarkRead(r.Context(), params["id"], profile.Id, params["messageId"], date)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			responses.NotFound(w, "Message not found")
+			return
+		}
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		// Read receipts are only sent when the marker moved
+		if advanced {
+			neededChannelsWs := []string{params["id"]}
+			var stallMessage = models.Event{
+				Type:    models.EventReadReceipt,
+				Payload: *state,
+				User:    profile.Name,
+			}
+			s.Hub().Broadcast(stallMessage, neededChannelsWs)
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(state)
+	}
+}
+
+func ListReadStatesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		if _, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember); !ok {
+			return
+		}
+		states, err := repository.ListChannelReadStates(r.Context(), params["id"])
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(states)
+	}
+}
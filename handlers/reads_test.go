@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/server"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReadReceipts(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	channel := ts.createChannel(alice, "general")
+	ts.addMember(alice, channel, bob)
+	first, second := ts.postMessage(alice, channel, "one"), ts.postMessage(alice, channel, "two")
+	socket := ts.dial(alice, channel.Id.Hex(), "acordia.v2")
+	ts.readFrame(socket, func(frame testFrame) bool { return frame.Type == models.EventHello })
+	read := func(message primitive.ObjectID) models.ReadState {
+		t.Helper()
+		var state models.ReadState
+		ts.expect(http.StatusOK, http.MethodPost, "/channel/"+channel.Id.Hex()+"/read/"+message.Hex(), bob.Token, nil, &state)
+		return state
+	}
+
+	if state := read(second.Id); state.LastRead != second.Id || state.UserId != bob.Id {
+		t.Fatalf("got the read state %+v", state)
+	}
+	frame := ts.readFrame(socket, func(frame testFrame) bool { return frame.Type == models.EventReadReceipt })
+	var receipt models.ReadState
+	if err := json.Unmarshal(frame.Payload, &receipt); err != nil || receipt.LastRead != second.Id {
+		t.Fatalf("got the receipt %s, %v", frame.Payload, err)
+	}
+	// The marker never moves back
+	if state := read(first.Id); state.LastRead != second.Id {
+		t.Fatalf("reading an older message moved the marker to %s", state.LastRead.Hex())
+	}
+	ts.expect(http.StatusNotFound, http.MethodPost, "/channel/"+channel.Id.Hex()+"/read/"+primitive.NewObjectID().Hex(), bob.Token, nil, nil)
+
+	var states []models.ReadState
+	ts.expect(http.StatusOK, http.MethodGet, "/channel/"+channel.Id.Hex()+"/reads", alice.Token, nil, &states)
+	if len(states) != 1 || states[0].UserId != bob.Id || states[0].LastRead != second.Id {
+		t.Fatalf("got the read states %+v", states)
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/gorilla/mux"
+)
+
+type SetChannelRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// SetChannelRoleHandler lets the owner promote or demote members, giving the
+// owner role to someone else transfers the channel and leaves the previous
+// owner as admin.
+func SetChannelRoleHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		var req = SetChannelRoleRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || !models.ValidRole(req.Role) {
+			responses.BadRequest(w, "Invalid role")
+			return
+		}
+		channel, ok := authorizeChannel(w, r, profile, params["id"], models.RoleMember)
+		if !ok || !writableChannel(w, channel) {
+			return
+		}
+		if channel.IsDirect() {
+			responses.Forbidden(w, "Direct messages have no roles")
+			return
+		}
+		if !requireRole(w, channel, profile, models.RoleOwner) {
+			return
+		}
+		if params["user"] == profile.Id.Hex() {
+			responses.BadRequest(w, "Transfer the channel to change your own role")
+			return
+		}
+		if req.Role == models.RoleOwner {
+			channel, err = repository.TransferChannel(r.Context(), params["id"], profile.Id.Hex(), params["user"])
+		} else {
+			channel, err = repository.SetChannelRole(r.Context(), params["id"], params["user"], req.Role)
+		}
+		if err != nil {
+			responses.NotFound(w, "Member not found")
+			return
+		}
+		neededChannelsWs := []string{params["id"]}
+		var stallMessage = models.Event{
+			Type:    models.EventMemberUpdated,
+			Payload: models.MemberPayload{Channel: *channel, Member: memberProfile(r.Context(), params["user"])},
+			User:    profile.Name,
+		}
+		s.Hub().Broadcast(stallMessage, neededChannelsWs)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(channel)
+	}
+}
+
+// authorizeChannel loads the channel and checks that the caller has at least
+// the required role in it, the error response is written when it returns
+// false. Deleted channels are not found.
+func authorizeChannel(w http.ResponseWriter, r *http.Request, profile *models.Profile, channelId string, required string) (*models.Channel, bool) {
+	channel, err := repository.GetChannelById(r.Context(), channelId)
+	if err != nil || channel.Deleted() {
+		responses.NotFound(w, "Channel not found")
+		return nil, false
+	}
+	if channel.RoleOf(profile.Id) == "" {
+		responses.Forbidden(w, "You are not a member of this channel")
+		return nil, false
+	}
+	if !requireRole(w, channel, profile, required) {
+		return nil, false
+	}
+	return channel, true
+}
+
+// requireRole is the role check of authorizeChannel, for handlers that check
+// something else about the channel first.
+func requireRole(w http.ResponseWriter, channel *models.Channel, profile *models.Profile, required string) bool {
+	if !channel.HasRole(profile.Id, required) {
+		responses.Forbidden(w, "This action requires the "+required+" role in the channel")
+		return false
+	}
+	return true
+}
+
+// writableChannel writes the error response and returns false when the
+// channel is archived, it has to be restored before any change.
+func writableChannel(w http.ResponseWriter, channel *models.Channel) bool {
+	if channel.Archived() {
+		responses.Forbidden(w, "The channel is archived")
+		return false
+	}
+	return true
+}
+
+// canRemoveMember allows members to leave, admins to remove members and the
+// owner to remove anyone but itself. Direct messages always keep both users.
+func canRemoveMember(w http.ResponseWriter, channel *models.Channel, profile *models.Profile, userId string) bool {
+	if channel.IsDirect() {
+		responses.Forbidden(w, "Members can not leave or be removed from direct messages")
+		return false
+	}
+	for _, user := range channel.Users {
+		if user.Id.Hex() != userId {
+			continue
+		}
+		target := channel.RoleOf(user.Id)
+		if target == models.RoleOwner {
+			responses.Forbidden(w, "The owner can not leave the channel, transfer it first")
+			return false
+		}
+		if user.Id == profile.Id {
+			return true
+		}
+		if target == models.RoleAdmin && !channel.HasRole(profile.Id, models.RoleOwner) {
+			responses.Forbidden(w, "Only the owner can remove admins")
+			return false
+		}
+		if !channel.HasRole(profile.Id, models.RoleAdmin) {
+			responses.Forbidden(w, "This action requires the admin role in the channel")
+			return false
+		}
+		return true
+	}
+	responses.NotFound(w, "Member not found")
+	return false
+}
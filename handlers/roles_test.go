@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/server"
+)
+
+func TestChannelRoles(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob, carol := ts.signup("Alice"), ts.signup("Bob"), ts.signup("Carol")
+	channel := ts.createChannel(alice, "general")
+	ts.addMember(alice, channel, bob)
+	role := func(user *testUser) string {
+		return "/channel/" + channel.Id.Hex() + "/role/" + user.Id.Hex()
+	}
+
+	// Members can not add users or change roles
+	ts.expect(http.StatusForbidden, http.MethodPatch, "/channel/event/addUser/"+channel.Id.Hex()+"/"+carol.Id.Hex(), bob.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPatch, role(bob), bob.Token, map[string]string{"role": models.RoleAdmin}, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPatch, role(bob), alice.Token, map[string]string{"role": "superuser"}, nil)
+	ts.expect(http.StatusNotFound, http.MethodPatch, role(carol), alice.Token, map[string]string{"role": models.RoleAdmin}, nil)
+
+	var updated models.Channel
+	ts.expect(http.StatusOK, http.MethodPatch, role(bob), alice.Token, map[string]string{"role": models.RoleAdmin}, &updated)
+	if got := updated.RoleOf(bob.Id); got != models.RoleAdmin {
+		t.Fatalf("bob has the role %q, want %q", got, models.RoleAdmin)
+	}
+	// Admins add users, only the owner changes roles
+	ts.addMember(bob, channel, carol)
+	ts.expect(http.StatusForbidden, http.MethodPatch, role(carol), bob.Token, map[string]string{"role": models.RoleAdmin}, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPatch, role(alice), alice.Token, map[string]string{"role": models.RoleMember}, nil)
+
+	// Giving the owner role transfers the channel
+	ts.expect(http.StatusOK, http.MethodPatch, role(carol), alice.Token, map[string]string{"role": models.RoleOwner}, &updated)
+	if updated.RoleOf(carol.Id) != models.RoleOwner || updated.RoleOf(alice.Id) != models.RoleAdmin {
+		t.Fatalf("the transfer left the roles %v", updated.Roles)
+	}
+	ts.expect(http.StatusForbidden, http.MethodPatch, role(bob), alice.Token, map[string]string{"role": models.RoleMember}, nil)
+
+	// Roles do not change while the channel is archived
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/"+channel.Id.Hex()+"/archive", carol.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPatch, role(bob), carol.Token, map[string]string{"role": models.RoleMember}, nil)
+}
+
+func TestRemoveMembers(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob, carol, dave := ts.signup("Alice"), ts.signup("Bob"), ts.signup("Carol"), ts.signup("Dave")
+	channel := ts.createChannel(alice, "general")
+	for _, user := range []*testUser{bob, carol, dave} {
+		ts.addMember(alice, channel, user)
+	}
+	id := channel.Id.Hex()
+	for _, admin := range []*testUser{bob, carol} {
+		ts.expect(http.StatusOK, http.MethodPatch, "/channel/"+id+"/role/"+admin.Id.Hex(), alice.Token, map[string]string{"role": models.RoleAdmin}, nil)
+	}
+	// The route of the first clients answers 201
+	remove := func(user *testUser) string {
+		return "/channel/event/removeUser/" + id + "/" + user.Id.Hex()
+	}
+
+	// Members only remove themselves, admins remove members and the owner
+	// anyone but itself
+	ts.expect(http.StatusForbidden, http.MethodPatch, remove(carol), dave.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPatch, remove(carol), bob.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPatch, remove(alice), alice.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodPost, "/channel/"+id+"/leave", alice.Token, nil, nil)
+	ts.expect(http.StatusCreated, http.MethodPatch, remove(dave), bob.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodPatch, remove(dave), bob.Token, nil, nil)
+	ts.expect(http.StatusCreated, http.MethodPatch, remove(carol), alice.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/channel/"+id+"/leave", bob.Token, nil, nil)
+	ts.expect(http.StatusForbidden, http.MethodGet, "/channel/"+id+"/messages", bob.Token, nil, nil)
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// startSession creates the session of a new login and the tokens for it.
+func startSession(r *http.Request, s server.Server, user *models.User, deviceName string) (*responses.LoginResponse, error) {
+	sessionId := primitive.NewObjectID()
+	refreshToken, refreshHash, err := auth.NewRefreshToken(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		Id:           sessionId,
+		UserId:       user.Id,
+		RefreshHash:  refreshHash,
+		DeviceName:   sessionDeviceName(deviceName, r.UserAgent()),
+		UserAgent:    truncate(r.UserAgent(), maxUserAgentLength),
+		IP:           clientIP(r),
+		CreatedAt:    now,
+		LastActiveAt: now,
+		ExpiresAt:    now.Add(auth.RefreshTokenTTL),
+	}
+	if _, err := repository.CreateSession(r.Context(), &session); err != nil {
+		return nil, err
+	}
+	accessToken, err := auth.NewAccessToken(s.Keys(), user.Id, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return &responses.LoginResponse{
+		Message:      "Welcome, you are logged in!",
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func RefreshTokenHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req = RefreshTokenRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		sessionId, hash, err := auth.ParseRefreshToken(req.RefreshToken)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		session, err := repository.GetSessionById(r.Context(), sessionId)
+		if err != nil || !session.Active(time.Now()) {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		refreshToken, newHash, err := auth.NewRefreshToken(session.Id)
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		err = repository.RotateSession(r.Context(), sessionId, hash, newHash, time.Now().Add(auth.RefreshTokenTTL))
+		if err != nil {
+			// A refresh token that was already rotated is being reused, someone
+			// else may hold it so the whole session is closed.
+			repository.RevokeSession(r.Context(), sessionId)
+			s.Hub().CloseSession(sessionId)
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		accessToken, err := auth.NewAccessToken(s.Keys(), session.UserId, session.Id)
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		json.NewEncoder(w).Encode(responses.LoginResponse{
+			Message:      "Token refreshed",
+			Token:        accessToken,
+			RefreshToken: refreshToken,
+			ExpiresIn:    int64(auth.AccessTokenTTL.Seconds()),
+		})
+	}
+}
+
+func LogoutHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		claims, err := middleware.TokenClaims(s, r)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Error validating token")
+			return
+		}
+		// Handle request
+		err = repository.RevokeSession(r.Context(), claims.SessionId.Hex())
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		s.Hub().CloseSession(claims.SessionId.Hex())
+		responses.DeleteResponse(w, "Logged out")
+	}
+}
+
+func LogoutAllHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		claims, err := middleware.TokenClaims(s, r)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Error validating token")
+			return
+		}
+		// Handle request
+		err = repository.RevokeUserSessions(r.Context(), claims.UserId, primitive.NilObjectID)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		s.Hub().CloseUserSessions(claims.UserId.Hex(), "")
+		responses.DeleteResponse(w, "Logged out from every device")
+	}
+}
+
+// ListSessionsHandler shows the devices the user is logged in on.
+func ListSessionsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		claims, err := middleware.TokenClaims(s, r)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Error validating token")
+			return
+		}
+		// Handle request
+		sessions, err := repository.ListUserSessions(r.Context(), claims.UserId, time.Now())
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		list := []responses.SessionResponse{}
+		for _, session := range sessions {
+			list = append(list, responses.SessionResponse{
+				Session: session,
+				Current: session.Id == claims.SessionId,
+			})
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// RevokeSessionHandler logs out one device of the user, its sockets are
+// closed right away.
+func RevokeSessionHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		claims, err := middleware.TokenClaims(s, r)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Error validating token")
+			return
+		}
+		// Handle request
+		params := mux.Vars(r)
+		session, err := repository.GetSessionById(r.Context(), params["id"])
+		// Sessions of other users are not found either
+		if err != nil || session.UserId != claims.UserId || !session.Active(time.Now()) {
+			responses.NotFound(w, "Session not found")
+			return
+		}
+		err = repository.RevokeSession(r.Context(), session.Id.Hex())
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		s.Hub().CloseSession(session.Id.Hex())
+		recordAudit(r, claims.UserId, models.AuditSessionRevoked)
+		responses.DeleteResponse(w, "Session revoked")
+	}
+}
+
+const (
+	maxDeviceNameLength = 64
+	maxUserAgentLength  = 512
+)
+
+// Checked in order, the first match names the browser or the system
+var (
+	userAgentBrowsers = [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	userAgentSystems = [][2]string{
+		{"Windows", "Windows"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// sessionDeviceName keeps the name sent by the client, or describes the user
+// agent like "Firefox on Linux".
+func sessionDeviceName(requested string, userAgent string) string {
+	if name := strings.TrimSpace(requested); name != "" {
+		return truncate(name, maxDeviceNameLength)
+	}
+	browser := userAgentMatch(userAgent, userAgentBrowsers)
+	system := userAgentMatch(userAgent, userAgentSystems)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
+
+func userAgentMatch(userAgent string, names [][2]string) string {
+	for _, name := range names {
+		if strings.Contains(userAgent, name[0]) {
+			return name[1]
+		}
+	}
+	return ""
+}
+
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length])
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+)
+
+func (ts *testServer) refresh(status int, refreshToken string) responses.LoginResponse {
+	ts.t.Helper()
+	var refreshed responses.LoginResponse
+	ts.expect(status, http.MethodPost, "/token/refresh", "", map[string]string{
+		"refresh_token": refreshToken,
+	}, &refreshed)
+	return refreshed
+}
+
+func TestRefreshRotatesTheTokens(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	login := ts.login(alice.Email, alice.Password)
+
+	refreshed := ts.refresh(http.StatusOK, login.RefreshToken)
+	if refreshed.Token == "" || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatal("the refresh did not rotate the tokens")
+	}
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", refreshed.Token, nil, nil)
+	ts.refresh(http.StatusUnauthorized, "not-a-refresh-token")
+
+	// Reusing a rotated token closes the whole session
+	ts.refresh(http.StatusUnauthorized, login.RefreshToken)
+	ts.refresh(http.StatusUnauthorized, refreshed.RefreshToken)
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", refreshed.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", alice.Token, nil, nil)
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	first, second := ts.login(alice.Email, alice.Password), ts.login(alice.Email, alice.Password)
+
+	ts.expect(http.StatusOK, http.MethodPost, "/logout", first.Token, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", first.Token, nil, nil)
+	ts.refresh(http.StatusUnauthorized, first.RefreshToken)
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", second.Token, nil, nil)
+
+	ts.expect(http.StatusOK, http.MethodPost, "/logout/all", second.Token, nil, nil)
+	for _, token := range []string{alice.Token, second.Token} {
+		ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", token, nil, nil)
+	}
+	ts.refresh(http.StatusUnauthorized, second.RefreshToken)
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	var phone responses.LoginResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/login", "", map[string]string{
+		"email":       alice.Email,
+		"password":    alice.Password,
+		"device_name": "  Alice's phone ",
+	}, &phone)
+
+	var sessions []responses.SessionResponse
+	ts.expect(http.StatusOK, http.MethodGet, "/sessions", phone.Token, nil, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("listed %d sessions, want 2", len(sessions))
+	}
+	var current responses.SessionResponse
+	for _, session := range sessions {
+		if session.Current {
+			current = session
+		}
+	}
+	if current.DeviceName != "Alice's phone" {
+		t.Fatalf("the current session is %+v", current)
+	}
+
+	// Sessions of other users are not found
+	id := current.Id.Hex()
+	ts.expect(http.StatusNotFound, http.MethodDelete, "/sessions/"+id, bob.Token, nil, nil)
+	ts.expect(http.StatusOK, http.MethodDelete, "/sessions/"+id, alice.Token, nil, nil)
+	ts.expect(http.StatusNotFound, http.MethodDelete, "/sessions/"+id, alice.Token, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", phone.Token, nil, nil)
+	ts.refresh(http.StatusUnauthorized, phone.RefreshToken)
+	ts.expect(http.StatusOK, http.MethodGet, "/sessions", alice.Token, nil, &sessions)
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("listed the sessions %+v after the revoke", sessions)
+	}
+}
+
+func TestSessionDeviceName(t *testing.T) {
+	names := map[[2]string]string{
+		{"", "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0"}:                                                "Firefox on Linux",
+		{"", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Edg/120.0"}: "Edge on Windows",
+		{"", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Safari/604.1"}:          "Safari on iOS",
+		{"", "curl/8.0.1"}:          "curl",
+		{"", ""}:                    "Unknown device",
+		{" Work laptop ", "curl/8"}: "Work laptop",
+	}
+	for input, want := range names {
+		if got := sessionDeviceName(input[0], input[1]); got != want {
+			t.Errorf("sessionDeviceName(%q, %q) = %q, want %q", input[0], input[1], got, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/server"
+	gorilla "github.com/gorilla/websocket"
+)
+
+func TestPostMessagesThroughTheSocket(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice, bob := ts.signup("Alice"), ts.signup("Bob")
+	channel := ts.createChannel(alice, "general")
+	ts.addMember(alice, channel, bob)
+	id := channel.Id.Hex()
+	sender, receiver := ts.dial(alice, id, "acordia.v2"), ts.dial(bob, id, "acordia.v2")
+	for _, socket := range []*gorilla.Conn{sender, receiver} {
+		ts.readFrame(socket, func(frame testFrame) bool { return frame.Type == models.EventHello })
+	}
+
+	post := func(socket *gorilla.Conn, frameId string, description string) testFrame {
+		t.Helper()
+		if err := socket.WriteJSON(map[string]interface{}{
+			"type":    models.EventPostMessage,
+			"id":      frameId,
+			"payload": models.PostMessagePayload{Description: description},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return ts.readFrame(socket, func(frame testFrame) bool {
+			return frame.Type == models.EventAck || frame.Type == models.EventError
+		})
+	}
+	ack := post(sender, "1", "hello")
+	var acked models.MessagePayload
+	if err := json.Unmarshal(ack.Payload, &acked); err != nil || ack.Type != models.EventAck || ack.Id != "1" {
+		t.Fatalf("got the answer %s %s, %v", ack.Type, ack.Payload, err)
+	}
+	frame := ts.readFrame(receiver, func(frame testFrame) bool { return frame.Type == models.EventMessageCreated })
+	var created models.MessagePayload
+	if err := json.Unmarshal(frame.Payload, &created); err != nil || created.Message.Id != acked.Message.Id || created.Message.Description != "hello" {
+		t.Fatalf("got the payload %s, %v", frame.Payload, err)
+	}
+
+	// Sockets of a thread post replies to its message
+	thread := ts.dial(bob, id+":"+acked.Message.Id.Hex(), "acordia.v2")
+	ts.readFrame(thread, func(frame testFrame) bool { return frame.Type == models.EventHello })
+	ack = post(thread, "2", "a reply")
+	var reply models.MessagePayload
+	if err := json.Unmarshal(ack.Payload, &reply); err != nil || ack.Type != models.EventAck {
+		t.Fatalf("got the answer %s %s, %v", ack.Type, ack.Payload, err)
+	}
+	if reply.Message.Parent == nil || *reply.Message.Parent != acked.Message.Id {
+		t.Fatalf("the reply has the parent %v", reply.Message.Parent)
+	}
+	ts.readFrame(sender, func(frame testFrame) bool { return frame.Type == models.EventThreadReply })
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TwoFactorLoginRequest struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	DeviceName   string `json:"device_name"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// ReauthRequest confirms the password before changing the two factor
+// configuration.
+type ReauthRequest struct {
+	Password string `json:"password"`
+}
+
+// newLoginChallenge is the first step of the login of an account with two
+// factor, the password was already checked.
+func newLoginChallenge(r *http.Request, user *models.User) (*responses.TwoFactorChallengeResponse, error) {
+	challenge, record, err := auth.NewUserToken(user.Id, models.TokenLoginChallenge, auth.LoginChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.CreateUserToken(r.Context(), record); err != nil {
+		return nil, err
+	}
+	return &responses.TwoFactorChallengeResponse{
+		Message:   "Two factor code required",
+		Challenge: challenge,
+		ExpiresIn: int64(auth.LoginChallengeTTL.Seconds()),
+	}, nil
+}
+
+// TwoFactorLoginHandler is the second step of the login, the challenge is
+// consumed by every attempt so a wrong code needs the password again.
+func TwoFactorLoginHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req = TwoFactorLoginRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		challenge, err := repository.UseUserToken(r.Context(), models.TokenLoginChallenge, auth.HashToken(req.Challenge), time.Now())
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Invalid or expired challenge")
+			return
+		}
+		user, err := repository.GetUserAccountById(r.Context(), challenge.UserId.Hex())
+		if err != nil || !user.TwoFactorEnabled() {
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Invalid credentials")
+			return
+		}
+		// The codes count against the same limits as the password
+		if !loginAllowed(w, r, user.Email) {
+			return
+		}
+		if req.RecoveryCode != "" {
+			err = repository.UseRecoveryCode(r.Context(), user.Id, auth.HashRecoveryCode(req.RecoveryCode))
+			if err == nil {
+				recordAudit(r, user.Id, models.AuditRecoveryCodeUse)
+			}
+		} else {
+			err = checkTOTP(r, user, req.Code)
+		}
+		if err != nil {
+			loginFailed(r, user.Email)
+			responses.NoAuthResponse(w, http.StatusUnauthorized, "Invalid two factor code")
+			return
+		}
+		loginSucceeded(r, user.Email)
+		login, err := startSession(r, s, user, req.DeviceName)
+		if err != nil {
+			responses.NoAuthResponse(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		json.NewEncoder(w).Encode(login)
+	}
+}
+
+// EnrollTwoFactorHandler creates a new secret, two factor is not enabled
+// until a code of it is confirmed.
+func EnrollTwoFactorHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		if profile.TwoFactorEnabled {
+			responses.BadRequest(w, "Two factor is already enabled")
+			return
+		}
+		secret, err := auth.NewTOTPSecret()
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		err = repository.SetTwoFactor(r.Context(), profile.Id, &models.TwoFactor{Secret: secret})
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(responses.TwoFactorEnrollResponse{
+			Secret: secret,
+			URI:    auth.TOTPProvisioningURI(secret, profile.Email),
+		})
+	}
+}
+
+func ConfirmTwoFactorHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		var req = TwoFactorCodeRequest{}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		user, err := repository.GetUserAccountById(r.Context(), profile.Id.Hex())
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		if user.TwoFactor == nil || user.TwoFactor.Enabled {
+			responses.BadRequest(w, "There is no pending two factor enrolment")
+			return
+		}
+		step, ok := auth.ValidateTOTP(user.TwoFactor.Secret, req.Code, time.Now())
+		if !ok {
+			responses.BadRequest(w, "Invalid two factor code")
+			return
+		}
+		codes, hashes, err := auth.NewRecoveryCodes()
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		err = repository.SetTwoFactor(r.Context(), user.Id, &models.TwoFactor{
+			Secret:        user.TwoFactor.Secret,
+			Enabled:       true,
+			RecoveryCodes: hashes,
+			LastStep:      step,
+		})
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		recordAudit(r, user.Id, models.AuditTwoFactorOn)
+		json.NewEncoder(w).Encode(responses.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+func DisableTwoFactorHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		user, ok := reauthenticate(w, r, profile)
+		if !ok {
+			return
+		}
+		err = repository.SetTwoFactor(r.Context(), user.Id, nil)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		recordAudit(r, user.Id, models.AuditTwoFactorOff)
+		responses.DeleteResponse(w, "Two factor disabled")
+	}
+}
+
+// RegenerateRecoveryCodesHandler replaces every recovery code of the user.
+func RegenerateRecoveryCodesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		user, ok := reauthenticate(w, r, profile)
+		if !ok {
+			return
+		}
+		if !user.TwoFactorEnabled() {
+			responses.BadRequest(w, "Two factor is not enabled")
+			return
+		}
+		codes, hashes, err := auth.NewRecoveryCodes()
+		if err != nil {
+			responses.InternalServerError(w, "Internal Server Error")
+			return
+		}
+		twoFactor := *user.TwoFactor
+		twoFactor.RecoveryCodes = hashes
+		err = repository.SetTwoFactor(r.Context(), user.Id, &twoFactor)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		recordAudit(r, user.Id, models.AuditRecoveryCodes)
+		json.NewEncoder(w).Encode(responses.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// reauthenticate checks the password sent in the body, the error response is
+// written when it returns false.
+func reauthenticate(w http.ResponseWriter, r *http.Request, profile *models.Profile) (*models.User, bool) {
+	var req = ReauthRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		responses.BadRequest(w, "Invalid request body")
+		return nil, false
+	}
+	user, err := repository.GetUserAccountById(r.Context(), profile.Id.Hex())
+	if err != nil {
+		responses.InternalServerError(w, "Internal Server Error")
+		return nil, false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		responses.NoAuthResponse(w, http.StatusUnauthorized, "The password is not correct")
+		return nil, false
+	}
+	return user, true
+}
+
+func checkTOTP(r *http.Request, user *models.User, code string) error {
+	step, ok := auth.ValidateTOTP(user.TwoFactor.Secret, code, time.Now())
+	if !ok {
+		return auth.ErrInvalidToken
+	}
+	return repository.UseTwoFactorStep(r.Context(), user.Id, step)
+}
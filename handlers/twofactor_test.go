@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+)
+
+// totpCode is the code an authenticator app shows for the secret.
+func totpCode(t *testing.T, secret string, now time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// enableTwoFactor enrolls the user and returns the secret, the recovery codes
+// and the time of the code used to confirm.
+func (ts *testServer) enableTwoFactor(user *testUser) (string, []string, time.Time) {
+	ts.t.Helper()
+	var enroll responses.TwoFactorEnrollResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/user/2fa/enroll", user.Token, nil, &enroll)
+	var recovery responses.RecoveryCodesResponse
+	now := time.Now()
+	ts.expect(http.StatusOK, http.MethodPost, "/user/2fa/confirm", user.Token, map[string]string{
+		"code": totpCode(ts.t, enroll.Secret, now),
+	}, &recovery)
+	return enroll.Secret, recovery.RecoveryCodes, now
+}
+
+// loginChallenge is the first step of the login with two factor.
+func (ts *testServer) loginChallenge(user *testUser) string {
+	ts.t.Helper()
+	var challenge responses.TwoFactorChallengeResponse
+	ts.expect(http.StatusAccepted, http.MethodPost, "/login", "", map[string]string{
+		"email":    user.Email,
+		"password": user.Password,
+	}, &challenge)
+	return challenge.Challenge
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/user/2fa/confirm", alice.Token, map[string]string{"code": "123456"}, nil)
+	secret, recovery, confirmed := ts.enableTwoFactor(alice)
+	var profile models.Profile
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", alice.Token, nil, &profile)
+	if !profile.TwoFactorEnabled {
+		t.Fatal("the profile does not show two factor enabled")
+	}
+
+	// The code of the confirmation can not be used again, the next one works
+	next := totpCode(t, secret, confirmed.Add(30*time.Second))
+	ts.expect(http.StatusUnauthorized, http.MethodPost, "/login/2fa", "", map[string]string{
+		"challenge": ts.loginChallenge(alice),
+		"code":      totpCode(t, secret, confirmed),
+	}, nil)
+	var login responses.LoginResponse
+	ts.expect(http.StatusOK, http.MethodPost, "/login/2fa", "", map[string]string{
+		"challenge": ts.loginChallenge(alice),
+		"code":      next,
+	}, &login)
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", login.Token, nil, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodPost, "/login/2fa", "", map[string]string{
+		"challenge": "not-a-challenge",
+		"code":      next,
+	}, nil)
+
+	// Recovery codes work once
+	for _, status := range []int{http.StatusOK, http.StatusUnauthorized} {
+		ts.expect(status, http.MethodPost, "/login/2fa", "", map[string]string{
+			"challenge":     ts.loginChallenge(alice),
+			"recovery_code": recovery[0],
+		}, nil)
+	}
+
+	ts.expect(http.StatusUnauthorized, http.MethodPost, "/user/2fa/disable", login.Token, map[string]string{"password": "not-the-password"}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/user/2fa/disable", login.Token, map[string]string{"password": alice.Password}, nil)
+	ts.login(alice.Email, alice.Password)
+}
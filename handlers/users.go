@@ -2,15 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/dg/acordia/middleware"
 	"github.com/dg/acordia/models"
 	"github.com/dg/acordia/repository"
 	"github.com/dg/acordia/responses"
 	"github.com/dg/acordia/server"
-	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,6 +18,8 @@ type SignUpLoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Name     string `json:"name"`
+	// Only used by the login, names the session
+	DeviceName string `json:"device_name"`
 }
 
 type UpdateUserRequest struct {
@@ -36,21 +38,37 @@ func SignUpHandler(s server.Server) http.HandlerFunc {
 			responses.BadRequest(w, "Invalid request body")
 			return
 		}
+		req.Email, err = normalizeEmail(req.Email)
+		if err != nil {
+			responses.BadRequest(w, err.Error())
+			return
+		}
+		if err := validatePassword(req.Password); err != nil {
+			responses.BadRequest(w, err.Error())
+			return
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			responses.NoAuthResponse(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 		createUser := models.InsertUser{
-			Email:    req.Email,
-			Password: string(hashedPassword),
-			Name:     req.Name,
+			Email:      req.Email,
+			Password:   string(hashedPassword),
+			Name:       req.Name,
+			Unverified: true,
 		}
 		profile, err := repository.InsertUser(r.Context(), &createUser)
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			responses.Conflict(w, "The email is already registered")
+			return
+		}
 		if err != nil {
 			responses.BadRequest(w, "Error creating user")
 			return
 		}
+		// The account is created even if the mail fails, it can be resent
+		logVerificationError(sendVerification(r.Context(), s, profile))
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(profile)
 	}
@@ -64,32 +82,42 @@ func LoginHandler(s server.Server) http.HandlerFunc {
 			responses.BadRequest(w, "Invalid request body")
 			return
 		}
+		req.Email = canonicalEmail(req.Email)
+		if !loginAllowed(w, r, req.Email) {
+			return
+		}
 		user, err := repository.GetUserByEmail(r.Context(), req.Email)
 		if user == nil {
+			loginFailed(r, req.Email)
 			responses.NoAuthResponse(w, http.StatusUnauthorized, "Invalid credentials")
 			return
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			loginFailed(r, req.Email)
 			responses.NoAuthResponse(w, http.StatusUnauthorized, "Invalid credentials")
 			return
 		}
-		claim := models.AppClaims{
-			UserId: user.Id,
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: time.Now().Add(time.Hour * 72).Unix(),
-			},
+		// The failures of the account are only cleared after the second
+		// factor, or the password could be retried between two codes
+		if user.TwoFactorEnabled() {
+			challenge, err := newLoginChallenge(r, user)
+			if err != nil {
+				responses.NoAuthResponse(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(challenge)
+			return
 		}
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
-		tokenString, err := token.SignedString([]byte(s.Config().JWTSecret))
+		loginSucceeded(r, req.Email)
+		login, err := startSession(r, s, user, req.DeviceName)
 		if err != nil {
 			responses.NoAuthResponse(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(responses.LoginResponse{
-			Message: "Welcome, you are logged in!",
-			Token:   tokenString,
-		})
+		json.NewEncoder(w).Encode(login)
 	}
 }
 
@@ -97,7 +125,10 @@ func ProfileHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		// Token validation
-		profile, _ := middleware.ValidateToken(s, w, r)
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
 		// Handle request
 		json.NewEncoder(w).Encode(profile)
 	}
@@ -136,6 +167,13 @@ func UpdateUserHandler(s server.Server) http.HandlerFunc {
 			responses.BadRequest(w, "Invalid request body")
 			return
 		}
+		if req.Email != "" {
+			req.Email, err = normalizeEmail(req.Email)
+			if err != nil {
+				responses.BadRequest(w, err.Error())
+				return
+			}
+		}
 		data := models.UpdateUser{
 			Id:        user.Id.Hex(),
 			Name:      req.Name,
@@ -144,10 +182,32 @@ func UpdateUserHandler(s server.Server) http.HandlerFunc {
 			DesertRef: req.DesertRef,
 		}
 		updatedUser, err := repository.UpdateUser(r.Context(), data)
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			responses.Conflict(w, "The email is already registered")
+			return
+		}
 		if err != nil {
 			responses.BadRequest(w, "Error updating user")
 			return
 		}
+		// A new email has to be verified again, the codes mailed to the old
+		// one stop working
+		if req.Email != "" && req.Email != user.Email {
+			err = repository.SetUserVerified(r.Context(), user.Id, false)
+			if err != nil {
+				responses.InternalServerError(w, err.Error())
+				return
+			}
+			for _, purpose := range []string{models.TokenEmailVerification, models.TokenPasswordReset} {
+				err = repository.ExpireUserTokens(r.Context(), user.Id, purpose)
+				if err != nil {
+					responses.InternalServerError(w, err.Error())
+					return
+				}
+			}
+			updatedUser.Unverified = true
+			logVerificationError(sendVerification(r.Context(), s, updatedUser))
+		}
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(updatedUser)
 	}
@@ -167,6 +227,17 @@ func DeleteUserHandler(s server.Server) http.HandlerFunc {
 			responses.BadRequest(w, "Error deleting user")
 			return
 		}
+		err = repository.RevokeUserSessions(r.Context(), user.Id, primitive.NilObjectID)
+		if err != nil {
+			responses.InternalServerError(w, "Error closing sessions")
+			return
+		}
+		s.Hub().CloseUserSessions(user.Id.Hex(), "")
+		err = repository.RevokeUserAPIKeys(r.Context(), user.Id)
+		if err != nil {
+			responses.InternalServerError(w, "Error revoking api keys")
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
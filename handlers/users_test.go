@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/server"
+)
+
+func TestSignupAndLogin(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+
+	var profile models.Profile
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", alice.Token, nil, &profile)
+	if profile.Id != alice.Id || profile.Email != "alice@example.com" {
+		t.Fatalf("got the profile %+v", profile)
+	}
+	ts.expect(http.StatusUnauthorized, http.MethodPost, "/login", "", map[string]string{
+		"email":    alice.Email,
+		"password": "not-the-password",
+	}, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodPost, "/login", "", map[string]string{
+		"email":    "nobody@example.com",
+		"password": alice.Password,
+	}, nil)
+	ts.expect(http.StatusUnauthorized, http.MethodGet, "/user/profile", "not-a-token", nil, nil)
+}
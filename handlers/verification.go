@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/dg/acordia/auth"
+	"github.com/dg/acordia/mailer"
+	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"github.com/dg/acordia/responses"
+	"github.com/dg/acordia/server"
+)
+
+// Minimum time between two verification mails for the same account
+const verificationResendInterval = time.Minute
+
+type ConfirmEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func ConfirmEmailHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req = ConfirmEmailRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			responses.BadRequest(w, "Invalid request body")
+			return
+		}
+		token, err := repository.UseUserToken(r.Context(), models.TokenEmailVerification, auth.HashToken(req.Token), time.Now())
+		if err != nil {
+			responses.BadRequest(w, "Invalid or expired verification code")
+			return
+		}
+		// A code only verifies the address it was mailed to
+		user, err := repository.GetUserById(r.Context(), token.UserId.Hex())
+		if err != nil || token.Email == "" || token.Email != user.Email {
+			responses.BadRequest(w, "Invalid or expired verification code")
+			return
+		}
+		err = repository.SetUserVerified(r.Context(), token.UserId, true)
+		if err != nil {
+			responses.InternalServerError(w, err.Error())
+			return
+		}
+		responses.DeleteResponse(w, "Email verified")
+	}
+}
+
+func ResendVerificationHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token validation
+		profile, err := middleware.ValidateToken(s, w, r)
+		if err != nil {
+			return
+		}
+		// Handle request
+		if !profile.Unverified {
+			responses.BadRequest(w, "The email is already verified")
+			return
+		}
+		last, err := repository.LatestUserToken(r.Context(), profile.Id, models.TokenEmailVerification)
+		if err == nil {
+			wait := time.Until(last.CreatedAt.Add(verificationResendInterval))
+			if wait > 0 {
+				responses.TooManyRequests(w, wait, "Wait before asking for another verification mail")
+				return
+			}
+		}
+		err = sendVerification(r.Context(), s, profile)
+		if err != nil {
+			responses.InternalServerError(w, "Error sending the verification mail")
+			return
+		}
+		responses.Accepted(w, "Verification mail sent")
+	}
+}
+
+// sendVerification mails a new verification code, the previous ones stay
+// valid until one of them is used.
+func sendVerification(ctx context.Context, s server.Server, profile *models.Profile) error {
+	token, record, err := auth.NewUserToken(profile.Id, models.TokenEmailVerification, auth.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	record.Email = profile.Email
+	if err := repository.CreateUserToken(ctx, record); err != nil {
+		return err
+	}
+	return s.Mailer().Send(ctx, mailer.Message{
+		To:      profile.Email,
+		Subject: "Verify your Acordia email",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this code to verify your email: %s\n\nIt expires in %d hours.",
+			profile.Name, token, int(auth.VerificationTTL.Hours())),
+	})
+}
+
+// requireVerified writes the error response and returns false when the
+// server only lets verified accounts do the action.
+func requireVerified(w http.ResponseWriter, s server.Server, profile *models.Profile, message string) bool {
+	if s.Config().RequireVerifiedEmail && profile.Unverified {
+		responses.Forbidden(w, message)
+		return false
+	}
+	return true
+}
+
+func logVerificationError(err error) {
+	if err != nil {
+		log.Println("Error sending verification mail:", err)
+	}
+}
+
+// canonicalEmail is how emails are stored and looked up.
+func canonicalEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeEmail returns the canonical form of the email, or an error when it
+// is not a bare address.
+func normalizeEmail(email string) (string, error) {
+	email = canonicalEmail(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", errors.New("Invalid email address")
+	}
+	return email, nil
+}
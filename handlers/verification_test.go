@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/server"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	valid := map[string]string{
+		"alice@example.com":        "alice@example.com",
+		"  Alice@Example.COM\n":    "alice@example.com",
+		"alice+chat@example.com":   "alice+chat@example.com",
+		"first.last@example.co.uk": "first.last@example.co.uk",
+	}
+	for email, want := range valid {
+		got, err := normalizeEmail(email)
+		if err != nil || got != want {
+			t.Errorf("normalizeEmail(%q) = %q, %v, want %q", email, got, err, want)
+		}
+	}
+	for _, email := range []string{"", "alice", "alice@", "@example.com", "Alice <alice@example.com>", "alice@example.com, bob@example.com"} {
+		if got, err := normalizeEmail(email); err == nil {
+			t.Errorf("normalizeEmail(%q) = %q, want an error", email, got)
+		}
+	}
+}
+
+func TestSignupEmailIsCheckedAndUnique(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	signup := func(email string) int {
+		return ts.do(http.MethodPost, "/signup", "", map[string]string{
+			"email":    email,
+			"password": "a-long-password-1",
+			"name":     "Alice",
+		}, nil)
+	}
+	if status := signup("not-an-email"); status != http.StatusBadRequest {
+		t.Fatalf("got status %d for an invalid email, want %d", status, http.StatusBadRequest)
+	}
+	var profile models.Profile
+	ts.expect(http.StatusOK, http.MethodPost, "/signup", "", map[string]string{
+		"email":    " Alice@Example.com ",
+		"password": "a-long-password-1",
+		"name":     "Alice",
+	}, &profile)
+	if profile.Email != "alice@example.com" {
+		t.Fatalf("stored the email %q", profile.Email)
+	}
+	if status := signup("ALICE@example.com"); status != http.StatusConflict {
+		t.Fatalf("got status %d for a registered email, want %d", status, http.StatusConflict)
+	}
+	ts.login("Alice@Example.com", "a-long-password-1")
+
+	bob := ts.signup("Bob")
+	ts.expect(http.StatusConflict, http.MethodPatch, "/user/update", bob.Token, map[string]string{
+		"email": "alice@example.com",
+	}, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPatch, "/user/update", bob.Token, map[string]string{
+		"email": "bob",
+	}, nil)
+	var updated models.Profile
+	ts.expect(http.StatusOK, http.MethodPatch, "/user/update", bob.Token, map[string]string{
+		"email": "Bob.New@example.com",
+	}, &updated)
+	if updated.Email != "bob.new@example.com" || !updated.Unverified {
+		t.Fatalf("got the profile %+v after the email change", updated)
+	}
+}
+
+func TestConfirmEmail(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	if !alice.Unverified {
+		t.Fatal("a new account is verified")
+	}
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/email/confirm", "", map[string]string{
+		"token": "not-a-code",
+	}, nil)
+	code := ts.mailCode(alice.Email)
+	ts.expect(http.StatusOK, http.MethodPost, "/email/confirm", "", map[string]string{"token": code}, nil)
+	// Codes are used once
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/email/confirm", "", map[string]string{"token": code}, nil)
+
+	var profile models.Profile
+	ts.expect(http.StatusOK, http.MethodGet, "/user/profile", alice.Token, nil, &profile)
+	if profile.Unverified {
+		t.Fatal("the account is still unverified")
+	}
+}
+
+func TestVerificationCodeOfTheOldEmail(t *testing.T) {
+	ts := newTestServer(t, server.Config{})
+	alice := ts.signup("Alice")
+	oldCode := ts.mailCode(alice.Email)
+
+	newEmail := "alice.new@example.com"
+	ts.expect(http.StatusOK, http.MethodPatch, "/user/update", alice.Token, map[string]string{
+		"email": newEmail,
+	}, nil)
+	ts.expect(http.StatusBadRequest, http.MethodPost, "/email/confirm", "", map[string]string{
+		"token": oldCode,
+	}, nil)
+	ts.expect(http.StatusOK, http.MethodPost, "/email/confirm", "", map[string]string{
+		"token": ts.mailCode(newEmail),
+	}, nil)
+}
@@ -0,0 +1,64 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+)
+
+func TestPublicKeyRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, public := range []interface{}{&rsaKey.PublicKey, edPublic} {
+		key, err := FromPublicKey("kid", "alg", public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The keys are read back from the json of the document
+		data, err := json.Marshal(Set{Keys: []Key{key}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var set Set
+		if err := json.Unmarshal(data, &set); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := set.Keys[0].PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch public := public.(type) {
+		case *rsa.PublicKey:
+			if !public.Equal(parsed) {
+				t.Fatal("the RSA key changed in the round trip")
+			}
+		case ed25519.PublicKey:
+			if !public.Equal(parsed) {
+				t.Fatal("the Ed25519 key changed in the round trip")
+			}
+		}
+	}
+}
+
+func TestUnsupportedKeys(t *testing.T) {
+	for _, key := range []Key{
+		{Kty: "EC", Crv: "P-256", X: "AA"},
+		{Kty: "OKP", Crv: "Ed448", X: "AA"},
+		{Kty: "OKP", Crv: "Ed25519", X: "AA"},
+	} {
+		if _, err := key.PublicKey(); err != ErrUnsupportedKey {
+			t.Errorf("got %v for %+v, want %v", err, key, ErrUnsupportedKey)
+		}
+	}
+	if _, err := FromPublicKey("kid", "HS256", []byte("secret")); err != ErrUnsupportedKey {
+		t.Errorf("got %v for a secret, want %v", err, ErrUnsupportedKey)
+	}
+}
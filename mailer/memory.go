@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// MemoryMailer keeps the sent mails so tests can read them, they are also
+// written to the log to be used in local development.
+type MemoryMailer struct {
+	mutex    *sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{mutex: &sync.Mutex{}}
+}
+
+func (mailer *MemoryMailer) Send(ctx context.Context, message Message) error {
+	mailer.mutex.Lock()
+	mailer.messages = append(mailer.messages, message)
+	mailer.mutex.Unlock()
+	log.Printf("Mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
+
+// Messages returns the mails sent to the address, oldest first.
+func (mailer *MemoryMailer) Messages(to string) []Message {
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	var messages []Message
+	for _, message := range mailer.messages {
+		if message.To == to {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
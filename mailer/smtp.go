@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPConfig struct {
+	// host:port of the server
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+type SMTPMailer struct {
+	config SMTPConfig
+	auth   smtp.Auth
+}
+
+func NewSMTPMailer(config SMTPConfig) (*SMTPMailer, error) {
+	if config.Addr == "" {
+		return nil, errors.New("smtp address is required")
+	}
+	if config.From == "" {
+		return nil, errors.New("smtp from address is required")
+	}
+	mailer := &SMTPMailer{config: config}
+	if config.Username != "" {
+		host, _, err := net.SplitHostPort(config.Addr)
+		if err != nil {
+			return nil, err
+		}
+		mailer.auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return mailer, nil
+}
+
+func (mailer *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return errors.New("invalid mail headers")
+	}
+	return smtp.SendMail(mailer.config.Addr, mailer.auth, mailer.config.From, []string{message.To}, format(mailer.config.From, message))
+}
+
+func format(from string, message Message) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		from, message.To, message.Subject, message.Body))
+}
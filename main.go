@@ -5,10 +5,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/dg/acordia/handlers"
 	"github.com/dg/acordia/middleware"
+	"github.com/dg/acordia/oidc"
 	"github.com/dg/acordia/server"
+	"github.com/dg/acordia/websocket"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
@@ -21,12 +24,32 @@ func main() {
 
 	PORT := os.Getenv("PORT")
 	JWT_SECRET := os.Getenv("JWT_SECRET")
+	JWT_KEYS_DIR := os.Getenv("JWT_KEYS_DIR")
 	DB_URI := os.Getenv("DB_URI")
+	MAILER_URI := os.Getenv("MAILER_URI")
+	REQUIRE_VERIFIED_EMAIL := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	CHANNEL_DELETE_GRACE := server.DefaultChannelDeleteGrace
+	if value := os.Getenv("CHANNEL_DELETE_GRACE"); value != "" {
+		CHANNEL_DELETE_GRACE, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatal("Invalid CHANNEL_DELETE_GRACE: ", err)
+		}
+	}
 
 	s, err := server.NewServer(context.Background(), &server.Config{
-		Port:      ":" + PORT,
-		JWTSecret: JWT_SECRET,
-		DbURI:     DB_URI,
+		Port:                 ":" + PORT,
+		JWTSecret:            JWT_SECRET,
+		JWTKeysDir:           JWT_KEYS_DIR,
+		DbURI:                DB_URI,
+		MailerURI:            MAILER_URI,
+		RequireVerifiedEmail: REQUIRE_VERIFIED_EMAIL,
+		ChannelDeleteGrace:   CHANNEL_DELETE_GRACE,
+		OIDC: oidc.Config{
+			Issuer:       os.Getenv("OIDC_ISSUER"),
+			ClientId:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		},
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -38,27 +61,88 @@ func main() {
 func BindRoutes(s server.Server, r *mux.Router) {
 	r.Use(middleware.CheckAuthMiddleware(s))
 	r.HandleFunc("/welcome", handlers.HomeHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler(s)).Methods(http.MethodGet)
 
 	//Auth
 	r.HandleFunc("/signup", handlers.SignUpHandler(s)).Methods(http.MethodPost)
 	r.HandleFunc("/login", handlers.LoginHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/login/2fa", handlers.TwoFactorLoginHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/oidc/login", handlers.OIDCLoginHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/oidc/callback", handlers.OIDCCallbackHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/token/refresh", handlers.RefreshTokenHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/logout", handlers.LogoutHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/logout/all", handlers.LogoutAllHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/sessions", handlers.ListSessionsHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/sessions/{id}", handlers.RevokeSessionHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/password/forgot", handlers.ForgotPasswordHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/password/reset", handlers.ResetPasswordHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/email/confirm", handlers.ConfirmEmailHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/email/resend", handlers.ResendVerificationHandler(s)).Methods(http.MethodPost)
 
 	//user
 	r.HandleFunc("/user/delete", handlers.DeleteUserHandler(s)).Methods(http.MethodDelete)
 	r.HandleFunc("/user/update", handlers.UpdateUserHandler(s)).Methods(http.MethodPatch)
 	r.HandleFunc("/user/profile", handlers.ProfileHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/user/password", handlers.ChangePasswordHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/2fa/enroll", handlers.EnrollTwoFactorHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/2fa/confirm", handlers.ConfirmTwoFactorHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/2fa/disable", handlers.DisableTwoFactorHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/2fa/recovery-codes", handlers.RegenerateRecoveryCodesHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/user/presence", handlers.UpdatePresenceHandler(s)).Methods(http.MethodPatch)
+
+	//bots and api keys
+	r.HandleFunc("/bots", handlers.CreateBotHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/bots", handlers.ListBotsHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/bots/{id}", handlers.DeleteBotHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/keys", handlers.CreateAPIKeyHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/keys", handlers.ListAPIKeysHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/keys/{id}", handlers.RevokeAPIKeyHandler(s)).Methods(http.MethodDelete)
+
+	//presence
+	r.HandleFunc("/presence", handlers.PresenceHandler(s)).Methods(http.MethodGet)
 
 	//channel
 	r.HandleFunc("/channel", handlers.CreateChannelHandler(s)).Methods(http.MethodPost)
 	r.HandleFunc("/channel/update/{id}", handlers.UpdateChannelHandler(s)).Methods(http.MethodPatch)
 	r.HandleFunc("/channel/delete/{id}", handlers.DeleteChannelHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/channel/{id}/archive", handlers.ArchiveChannelHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/restore", handlers.RestoreChannelHandler(s)).Methods(http.MethodPost)
 
 	//events channels
 	r.HandleFunc("/channel/event/addUser/{id}/{user}", handlers.AddUserToChannelHandler(s)).Methods(http.MethodPatch)
 	r.HandleFunc("/channel/event/removeUser/{id}/{user}", handlers.RemoveUserHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/{id}/role/{user}", handlers.SetChannelRoleHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/{id}/invites", handlers.CreateInviteHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/invites", handlers.ListInvitesHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/{id}/invites/{inviteId}", handlers.RevokeInviteHandler(s)).Methods(http.MethodDelete)
 	r.HandleFunc("/channel/event/addMessage/{id}", handlers.AddMessagesToChannelHandler(s)).Methods(http.MethodPatch)
 	r.HandleFunc("/channel/list", handlers.ListOfChannelsHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/dm/group", handlers.CreateGroupMessageHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/dm/{user}", handlers.OpenDirectMessageHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/discover", handlers.DiscoverChannelsHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/{id}/join", handlers.JoinChannelHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/leave", handlers.LeaveChannelHandler(s)).Methods(http.MethodPost)
+
+	//invites
+	r.HandleFunc("/invite/{code}", handlers.PreviewInviteHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/join/{code}", handlers.RedeemInviteHandler(s)).Methods(http.MethodPost)
+
+	//messages
+	r.HandleFunc("/channel/{id}/messages", handlers.ListMessagesHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/{id}/messages", handlers.CreateMessageHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/message/{messageId}", handlers.UpdateMessageHandler(s)).Methods(http.MethodPatch)
+	r.HandleFunc("/channel/{id}/message/{messageId}", handlers.DeleteMessageHandler(s)).Methods(http.MethodDelete)
+	r.HandleFunc("/channel/{id}/message/{messageId}/replies", handlers.AddReplyHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/message/{messageId}/replies", handlers.ListRepliesHandler(s)).Methods(http.MethodGet)
+	r.HandleFunc("/channel/{id}/message/{messageId}/reactions/{emoji}", handlers.AddReactionHandler(s)).Methods(http.MethodPut)
+	r.HandleFunc("/channel/{id}/message/{messageId}/reactions/{emoji}", handlers.RemoveReactionHandler(s)).Methods(http.MethodDelete)
+
+	//read states
+	r.HandleFunc("/channel/{id}/read/{messageId}", handlers.MarkReadHandler(s)).Methods(http.MethodPost)
+	r.HandleFunc("/channel/{id}/reads", handlers.ListReadStatesHandler(s)).Methods(http.MethodGet)
 
 	// WebSocket
-	r.HandleFunc("/ws/{Authorization}/{Channel}", s.Hub().HandleWebSocket(s.Config().JWTSecret))
+	s.Hub().SetMessagePoster(handlers.SocketMessagePoster(s))
+	r.HandleFunc("/ws/{Authorization}/{Channel}", s.Hub().HandleWebSocket(s.Keys()))
+	r.HandleFunc("/protocol/schema.json", websocket.SchemaHandler()).Methods(http.MethodGet)
 }
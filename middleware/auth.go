@@ -1,31 +1,55 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
+	"github.com/dg/acordia/auth"
 	"github.com/dg/acordia/models"
 	"github.com/dg/acordia/repository"
 	"github.com/dg/acordia/responses"
 	"github.com/dg/acordia/server"
-	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 )
 
 var (
+	// Route templates, matched whole so a path parameter can never make a
+	// route public
 	NO_AUTH_NEEDED = []string{
 		"/welcome",
-		"login",
-		"signup",
+		"/login",
+		"/login/2fa",
+		"/signup",
+		"/protocol/schema.json",
+		"/token/refresh",
+		"/password/forgot",
+		"/password/reset",
+		"/email/confirm",
+		"/oidc/login",
+		"/oidc/callback",
+		"/.well-known/jwks.json",
+		"/invite/{code}",
 	}
 	AUTH_BY_PARAMS = []string{
-		"ws",
+		"/ws/{Authorization}/{Channel}",
 	}
 )
 
+// routeTemplate is the template of the matched route, like
+// /channel/{id}/messages.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
 func shouldCheckAuth(route string) bool {
 	for _, p := range NO_AUTH_NEEDED {
-		if strings.Contains(route, p) {
+		if route == p {
 			return false
 		}
 	}
@@ -34,7 +58,7 @@ func shouldCheckAuth(route string) bool {
 
 func authByParams(route string) bool {
 	for _, p := range AUTH_BY_PARAMS {
-		if strings.Contains(route, p) {
+		if route == p {
 			return false
 		}
 	}
@@ -44,18 +68,30 @@ func authByParams(route string) bool {
 func CheckAuthMiddleware(s server.Server) func(h http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !shouldCheckAuth(r.URL.Path) {
+			route := routeTemplate(r)
+			if !shouldCheckAuth(route) {
 				next.ServeHTTP(w, r)
 				return
 			}
 			tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-			if !authByParams(r.URL.Path) {
+			if !authByParams(route) {
 				params := mux.Vars(r)
 				tokenString = strings.TrimSpace(params["Authorization"])
 			}
-			_, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(s.Config().JWTSecret), nil
-			})
+			if auth.IsAPIKey(tokenString) {
+				key, err := auth.ParseAPIKey(r.Context(), tokenString)
+				if err != nil {
+					responses.NoAuthResponse(w, http.StatusUnauthorized, "Expired or invalid api key")
+					return
+				}
+				if !apiKeyAllowed(key, r) {
+					responses.Forbidden(w, "The api key is not allowed to call this route")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			_, err := auth.ParseAccessToken(r.Context(), s.Keys(), tokenString)
 			if err != nil {
 				responses.NoAuthResponse(w, http.StatusUnauthorized, "Expired or invalid token")
 				return
@@ -65,24 +101,77 @@ func CheckAuthMiddleware(s server.Server) func(h http.Handler) http.Handler {
 	}
 }
 
+// apiKeyAllowed checks the scopes of the key, it runs in the middleware and
+// again when the handler loads the caller.
+func apiKeyAllowed(key *models.APIKey, r *http.Request) bool {
+	scope, ok := apiKeyScope(r)
+	return ok && key.HasScope(scope)
+}
+
+// apiKeyScope returns the scope an api key needs for the request, api keys
+// can only call the channel and message routes.
+func apiKeyScope(r *http.Request) (string, bool) {
+	path := routeTemplate(r)
+	if !strings.HasPrefix(path, "/channel") {
+		return "", false
+	}
+	read := r.Method == http.MethodGet
+	if strings.Contains(path, "/message") || strings.Contains(path, "addMessage") || strings.Contains(path, "/read") {
+		if read {
+			return models.ScopeMessagesRead, true
+		}
+		return models.ScopeMessagesWrite, true
+	}
+	if read {
+		return models.ScopeChannelsRead, true
+	}
+	return models.ScopeChannelsWrite, true
+}
+
+// ValidateToken returns the profile of the caller, authenticated with an
+// access token or an api key.
 func ValidateToken(s server.Server, w http.ResponseWriter, r *http.Request) (*models.Profile, error) {
-	tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-	token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.Config().JWTSecret), nil
-	})
+	userId, err := callerId(s, r)
+	if errors.Is(err, ErrScopeDenied) {
+		responses.Forbidden(w, "The api key is not allowed to call this route")
+		return nil, err
+	}
+	if err != nil {
+		responses.NoAuthResponse(w, http.StatusUnauthorized, "Error validating token")
+		return nil, err
+	}
+	profile, err := repository.GetUserById(r.Context(), userId)
 	if err != nil {
 		responses.NoAuthResponse(w, http.StatusUnauthorized, "Error validating token")
 		return nil, err
 	}
-	if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-		userId := claims.UserId.Hex()
-		profile, err := repository.GetUserById(r.Context(), userId)
+	return profile, nil
+}
+
+var ErrScopeDenied = errors.New("the api key is not allowed to call this route")
+
+func callerId(s server.Server, r *http.Request) (string, error) {
+	tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
+	if auth.IsAPIKey(tokenString) {
+		key, err := auth.ParseAPIKey(r.Context(), tokenString)
 		if err != nil {
-			responses.NoAuthResponse(w, http.StatusUnauthorized, "Error validating token")
-			return nil, err
+			return "", err
 		}
-		return profile, nil
-	} else {
-		return nil, err
+		if !apiKeyAllowed(key, r) {
+			return "", ErrScopeDenied
+		}
+		return key.UserId.Hex(), nil
+	}
+	claims, err := TokenClaims(s, r)
+	if err != nil {
+		return "", err
 	}
+	return claims.UserId.Hex(), nil
+}
+
+// TokenClaims returns the claims of the token of the request without writing
+// any response, for the handlers that need the session of the caller.
+func TokenClaims(s server.Server, r *http.Request) (*models.AppClaims, error) {
+	tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
+	return auth.ParseAccessToken(r.Context(), s.Keys(), tokenString)
 }
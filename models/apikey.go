@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scopes of the api keys, a key can only call the routes of its scopes.
+const (
+	ScopeChannelsRead  = "channels:read"
+	ScopeChannelsWrite = "channels:write"
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+)
+
+var Scopes = []string{ScopeChannelsRead, ScopeChannelsWrite, ScopeMessagesRead, ScopeMessagesWrite}
+
+// APIKey authenticates as UserId, a human or one of its bots, only the hash
+// of the key is stored and the prefix identifies it.
+type APIKey struct {
+	Id         primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	CreatedBy  primitive.ObjectID `bson:"created_by" json:"created_by"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	Hash       string             `bson:"hash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Revoked    bool               `bson:"revoked" json:"revoked"`
+}
+
+func ValidScope(scope string) bool {
+	for _, current := range Scopes {
+		if current == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports if the key can still be used.
+func (key *APIKey) Active(now time.Time) bool {
+	return !key.Revoked && (key.ExpiresAt == nil || now.Before(*key.ExpiresAt))
+}
+
+func (key *APIKey) HasScope(scope string) bool {
+	for _, current := range key.Scopes {
+		if current == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempts counts the failed logins of an account or an address, the
+// record is forgotten once it expires.
+type LoginAttempts struct {
+	Key         string    `bson:"_id" json:"key"`
+	Failures    int       `bson:"failures" json:"failures"`
+	LastFailure time.Time `bson:"last_failure" json:"last_failure"`
+	ExpiresAt   time.Time `bson:"expires_at" json:"expires_at"`
+}
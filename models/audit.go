@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditPasswordChanged = "password.changed"
+	AuditPasswordReset   = "password.reset"
+	AuditTwoFactorOn     = "two_factor.enabled"
+	AuditTwoFactorOff    = "two_factor.disabled"
+	AuditRecoveryCodes   = "two_factor.recovery_codes"
+	AuditRecoveryCodeUse = "two_factor.recovery_code_used"
+	AuditOIDCLinked      = "oidc.linked"
+	AuditSessionRevoked  = "session.revoked"
+)
+
+// AuditEntry records a security relevant action done on an account.
+type AuditEntry struct {
+	Id        primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Action    string             `bson:"action" json:"action"`
+	IP        string             `bson:"ip" json:"ip"`
+	UserAgent string             `bson:"user_agent" json:"user_agent"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -1,10 +1,48 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Roles of the members of a channel, each one can do everything the roles
+// after it can.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Visibility of a channel, public channels are listed in the directory and
+// anyone can join them. Channels without one are private.
+const (
+	VisibilityPrivate = "private"
+	VisibilityPublic  = "public"
+)
+
+// Kinds of channel. A direct message is between two users and found by the
+// pair, a group direct message is a small private conversation without a
+// name. Channels without a kind are regular channels.
+const (
+	KindChannel = "channel"
+	KindDirect  = "direct"
+	KindGroup   = "group"
+)
+
+// Group direct messages can not grow past this many members
+const MaxGroupMembers = 10
+
+var roleLevels = map[string]int{
+	RoleOwner:  3,
+	RoleAdmin:  2,
+	RoleMember: 1,
+}
 
 type Channel struct {
 	Id                  primitive.ObjectID `bson:"_id" json:"_id"`
 	Users               []Profile          `bson:"users" json:"users"`
+	Roles               map[string]string  `bson:"roles,omitempty" json:"roles"`
 	Color               string             `bson:"color" json:"color"`
 	Background          string             `bson:"background" json:"background"`
 	DesertRefBackground string             `bson:"desert_ref_background" json:"desert_ref_background"`
@@ -13,36 +51,131 @@ type Channel struct {
 	CreateDate          string             `bson:"create_date" json:"create_date"`
 	Description         string             `bson:"description" json:"description"`
 	Name                string             `bson:"name" json:"name"`
-	Messages            []ChannelMessage   `bson:"messages" json:"messages"`
-}
-
-type ChannelMessage struct {
-	User        Profile `bson:"user" json:"user"`
-	Date        string  `bson:"date" json:"date"`
-	Description string  `bson:"description" json:"description"`
-	Image       string  `bson:"image" json:"image"`
-	DesertRef   string  `bson:"desert_ref" json:"desert_ref"`
+	Visibility          string             `bson:"visibility,omitempty" json:"visibility"`
+	Tags                []string           `bson:"tags,omitempty" json:"tags"`
+	Kind                string             `bson:"kind,omitempty" json:"kind"`
+	// Unordered pair of a direct message, see DirectKey
+	DirectKey string `bson:"direct_key,omitempty" json:"-"`
+	// Archived channels are read only, deleted ones can be restored until
+	// PurgeAt
+	ArchivedAt *time.Time `bson:"archived_at,omitempty" json:"archived_at,omitempty"`
+	DeletedAt  *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	PurgeAt    *time.Time `bson:"purge_at,omitempty" json:"purge_at,omitempty"`
 }
 
 type InsertChannel struct {
-	Users               []Profile        `bson:"users" json:"users"`
-	Color               string           `bson:"color" json:"color"`
-	Background          string           `bson:"background" json:"background"`
-	DesertRefBackground string           `bson:"desert_ref_background" json:"desert_ref_background"`
-	Image               string           `bson:"image" json:"image"`
-	DesertRefImage      string           `bson:"desert_ref_image" json:"desert_ref_image"`
-	CreateDate          string           `bson:"create_date" json:"create_date"`
-	Description         string           `bson:"description" json:"description"`
-	Name                string           `bson:"name" json:"name"`
-	Messages            []ChannelMessage `bson:"messages" json:"messages"`
+	Users               []Profile         `bson:"users" json:"users"`
+	Roles               map[string]string `bson:"roles" json:"roles"`
+	Color               string            `bson:"color" json:"color"`
+	Background          string            `bson:"background" json:"background"`
+	DesertRefBackground string            `bson:"desert_ref_background" json:"desert_ref_background"`
+	Image               string            `bson:"image" json:"image"`
+	DesertRefImage      string            `bson:"desert_ref_image" json:"desert_ref_image"`
+	CreateDate          string            `bson:"create_date" json:"create_date"`
+	Description         string            `bson:"description" json:"description"`
+	Name                string            `bson:"name" json:"name"`
+	Visibility          string            `bson:"visibility" json:"visibility"`
+	Tags                []string          `bson:"tags,omitempty" json:"tags"`
+	Kind                string            `bson:"kind" json:"kind"`
+	DirectKey           string            `bson:"direct_key,omitempty" json:"-"`
 }
 
 type UpdateChannel struct {
-	Name                string           `bson:"name" json:"name"`
-	Description         string           `bson:"description" json:"description"`
-	Color               string           `bson:"color" json:"color"`
-	Background          string           `bson:"background" json:"background"`
-	DesertRefBackground string           `bson:"desert_ref_background" json:"desert_ref_background"`
-	Image               string           `bson:"image" json:"image"`
-	DesertRefImage      string           `bson:"desert_ref_image" json:"desert_ref_image"`
-}
\ No newline at end of file
+	Name                string `bson:"name" json:"name"`
+	Description         string `bson:"description" json:"description"`
+	Color               string `bson:"color" json:"color"`
+	Background          string `bson:"background" json:"background"`
+	DesertRefBackground string `bson:"desert_ref_background" json:"desert_ref_background"`
+	Image               string `bson:"image" json:"image"`
+	DesertRefImage      string `bson:"desert_ref_image" json:"desert_ref_image"`
+	Visibility          string `bson:"visibility" json:"visibility"`
+	// Nil keeps the tags, an empty list removes them
+	Tags []string `bson:"tags" json:"tags"`
+}
+
+// ChannelSearch selects a page of the public channels, the newest first.
+// After is the exclusive id the page starts after, the zero value starts
+// from the newest channel. A channel must have every tag.
+type ChannelSearch struct {
+	Query string
+	Tags  []string
+	After primitive.ObjectID
+	Limit int
+}
+
+// RoleOf returns the role of the user in the channel, or an empty string when
+// the user is not a member. Members without a stored role are plain members,
+// channels created before the roles existed have their creator, the first
+// user, as owner.
+func (channel *Channel) RoleOf(userId primitive.ObjectID) string {
+	member := false
+	for _, user := range channel.Users {
+		if user.Id == userId {
+			member = true
+			break
+		}
+	}
+	if !member {
+		return ""
+	}
+	if role, ok := channel.Roles[userId.Hex()]; ok {
+		return role
+	}
+	hasOwner := false
+	for _, role := range channel.Roles {
+		if role == RoleOwner {
+			hasOwner = true
+		}
+	}
+	if !hasOwner && channel.Users[0].Id == userId {
+		return RoleOwner
+	}
+	return RoleMember
+}
+
+// HasRole reports if the user has at least the required role.
+func (channel *Channel) HasRole(userId primitive.ObjectID, required string) bool {
+	return roleLevels[channel.RoleOf(userId)] >= roleLevels[required]
+}
+
+// DirectKey is the same for both orders of the pair.
+func DirectKey(first primitive.ObjectID, second primitive.ObjectID) string {
+	if first.Hex() > second.Hex() {
+		first, second = second, first
+	}
+	return first.Hex() + ":" + second.Hex()
+}
+
+// IsDirect reports if the channel is a direct message between two users.
+func (channel *Channel) IsDirect() bool {
+	return channel.Kind == KindDirect
+}
+
+// IsConversation reports if the channel is a direct message or a group
+// direct message.
+func (channel *Channel) IsConversation() bool {
+	return channel.Kind == KindDirect || channel.Kind == KindGroup
+}
+
+func (channel *Channel) Archived() bool {
+	return channel.ArchivedAt != nil
+}
+
+// Deleted reports if the channel waits to be purged.
+func (channel *Channel) Deleted() bool {
+	return channel.DeletedAt != nil
+}
+
+// Public reports if the channel is listed and open to everyone.
+func (channel *Channel) Public() bool {
+	return channel.Visibility == VisibilityPublic && !channel.Archived() && !channel.Deleted()
+}
+
+func ValidVisibility(visibility string) bool {
+	return visibility == VisibilityPrivate || visibility == VisibilityPublic
+}
+
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
@@ -6,6 +6,7 @@ import (
 )
 
 type AppClaims struct {
-	UserId primitive.ObjectID `bson:"userId"`
+	UserId    primitive.ObjectID `bson:"userId"`
+	SessionId primitive.ObjectID `bson:"sessionId"`
 	jwt.StandardClaims
 }
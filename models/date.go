@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// CurrentDate is the format used for every date stored by acordia.
+func CurrentDate() (string, error) {
+	loc, err := time.LoadLocation("America/Bogota")
+	if err != nil {
+		return "", err
+	}
+	return time.Now().In(loc).Format("2006-01-02 15:04:05"), nil
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Versions of the websocket protocol. Clients that do not ask for a version
+// when they connect keep receiving the legacy frames with numeric codes.
+const (
+	LegacyProtocolVersion = 1
+	ProtocolVersion       = 2
+)
+
+type EventType string
+
+// Events sent by the server
+const (
+	EventHello           EventType = "hello"
+	EventMessageCreated  EventType = "message.created"
+	EventMessageUpdated  EventType = "message.updated"
+	EventMessageDeleted  EventType = "message.deleted"
+	EventThreadReply     EventType = "thread.reply"
+	EventReactionChanged EventType = "reaction.changed"
+	EventReadReceipt     EventType = "read.receipt"
+	EventTyping          EventType = "typing"
+	EventPresenceChanged EventType = "presence.changed"
+	EventChannelUpdated  EventType = "channel.updated"
+	EventMemberAdded     EventType = "member.added"
+	EventMemberRemoved   EventType = "member.removed"
+	EventMemberUpdated   EventType = "member.updated"
+	EventChannelDeleted  EventType = "channel.deleted"
+	EventChannelArchived EventType = "channel.archived"
+	EventChannelRestored EventType = "channel.restored"
+	EventAck             EventType = "ack"
+	EventError           EventType = "error"
+)
+
+// Events sent by the clients
+const (
+	EventTypingUpdate EventType = "typing"
+	EventPostMessage  EventType = "message.post"
+)
+
+// Event is a frame of the current protocol. Id is only set on the answers to
+// a frame sent by the client and repeats the id it used.
+type Event struct {
+	Type    EventType   `json:"type"`
+	Version int         `json:"version"`
+	Id      string      `json:"id,omitempty"`
+	User    string      `json:"user,omitempty"`
+	Payload interface{} `json:"payload"`
+}
+
+type HelloPayload struct {
+	Version int         `json:"version"`
+	Events  []EventType `json:"events"`
+}
+
+type MessagePayload struct {
+	Message ChannelMessage `json:"message"`
+	// Only sent to the legacy clients, see Legacy
+	LegacyChannel *LegacyChannel `json:"-"`
+}
+
+// LegacyChannel is the channel as the first protocol sent it, with its
+// latest messages embedded.
+type LegacyChannel struct {
+	Channel
+	Messages []ChannelMessage `json:"messages"`
+}
+
+type ChannelPayload struct {
+	Channel Channel `json:"channel"`
+}
+
+type MemberPayload struct {
+	Channel Channel `json:"channel"`
+	Member  Profile `json:"member"`
+}
+
+// ChannelDeletedPayload carries when the channel is purged, until then the
+// owner can restore it. It is not set when the channel is deleted right away.
+type ChannelDeletedPayload struct {
+	ChannelId primitive.ObjectID `json:"channel_id"`
+	PurgeAt   *time.Time         `json:"purge_at,omitempty"`
+}
+
+type ErrorPayload struct {
+	Message string `json:"message"`
+}
+
+type TypingPayload struct {
+	Typing bool `json:"typing"`
+}
+
+type PostMessagePayload struct {
+	Description string   `json:"description"`
+	Image       string   `json:"image"`
+	DesertRef   string   `json:"desert_ref"`
+	Mentions    []string `json:"mentions"`
+}
+
+// ServerEvents lists every event a client can receive with the type of its
+// payload, it is the source of the published schema.
+var ServerEvents = map[EventType]interface{}{
+	EventHello:           HelloPayload{},
+	EventMessageCreated:  MessagePayload{},
+	EventMessageUpdated:  MessagePayload{},
+	EventMessageDeleted:  MessagePayload{},
+	EventThreadReply:     ThreadReply{},
+	EventReactionChanged: ReactionDelta{},
+	EventReadReceipt:     ReadState{},
+	EventTyping:          TypingEvent{},
+	EventPresenceChanged: Presence{},
+	EventChannelUpdated:  ChannelPayload{},
+	EventMemberAdded:     MemberPayload{},
+	EventMemberRemoved:   MemberPayload{},
+	EventMemberUpdated:   MemberPayload{},
+	EventChannelDeleted:  ChannelDeletedPayload{},
+	EventChannelArchived: ChannelPayload{},
+	EventChannelRestored: ChannelPayload{},
+	EventAck:             MessagePayload{},
+	EventError:           ErrorPayload{},
+}
+
+// ClientEvents lists the frames the clients can send.
+var ClientEvents = map[EventType]interface{}{
+	EventTypingUpdate: TypingPayload{},
+	EventPostMessage:  PostMessagePayload{},
+}
+
+var legacyCodes = map[EventType]string{
+	EventMessageCreated:  "2",
+	EventChannelUpdated:  "2",
+	EventMemberAdded:     "2",
+	EventMemberRemoved:   "2",
+	EventMemberUpdated:   "2",
+	EventChannelDeleted:  "3",
+	EventMessageUpdated:  "4",
+	EventMessageDeleted:  "5",
+	EventThreadReply:     "6",
+	EventReactionChanged: "7",
+	EventReadReceipt:     "8",
+	EventTyping:          "9",
+	EventPresenceChanged: "10",
+	EventAck:             "12",
+	EventError:           "13",
+}
+
+// LegacyEventTypes maps the codes the legacy clients send to the events.
+var LegacyEventTypes = map[string]EventType{
+	"9":  EventTypingUpdate,
+	"11": EventPostMessage,
+}
+
+// Legacy builds the frame of the first protocol, the payloads there were the
+// bare document instead of the typed structs. Events that did not exist in
+// that protocol return false.
+func (event Event) Legacy() (WebsocketMessage, bool) {
+	code, ok := legacyCodes[event.Type]
+	if !ok {
+		return WebsocketMessage{}, false
+	}
+	payload := event.Payload
+	switch value := event.Payload.(type) {
+	case MessagePayload:
+		payload = value.Message
+		if value.LegacyChannel != nil {
+			payload = *value.LegacyChannel
+		}
+	case ChannelPayload:
+		payload = value.Channel
+	case MemberPayload:
+		payload = value.Channel
+	case ChannelDeletedPayload:
+		payload = value.ChannelId.Hex()
+	}
+	return WebsocketMessage{Code: code, Id: event.Id, Payload: payload, User: event.User}, true
+}
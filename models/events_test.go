@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLegacy(t *testing.T) {
+	message := ChannelMessage{Id: primitive.NewObjectID(), Description: "hello"}
+	channel := LegacyChannel{Channel: Channel{Id: primitive.NewObjectID()}, Messages: []ChannelMessage{message}}
+
+	frame, ok := Event{Type: EventMessageUpdated, Id: "1", Payload: MessagePayload{Message: message}, User: "alice"}.Legacy()
+	if !ok || frame.Code != "4" || frame.Id != "1" || frame.User != "alice" {
+		t.Fatalf("got the frame %+v, %v", frame, ok)
+	}
+	if payload, ok := frame.Payload.(ChannelMessage); !ok || payload.Id != message.Id {
+		t.Fatalf("the legacy payload is %#v, want the bare message", frame.Payload)
+	}
+
+	// New messages carried the whole channel when it is loaded
+	frame, _ = Event{Type: EventMessageCreated, Payload: MessagePayload{Message: message, LegacyChannel: &channel}}.Legacy()
+	if payload, ok := frame.Payload.(LegacyChannel); !ok || payload.Id != channel.Id || frame.Code != "2" {
+		t.Fatalf("got the frame %+v, want the channel", frame)
+	}
+	frame, _ = Event{Type: EventMessageCreated, Payload: MessagePayload{Message: message}}.Legacy()
+	if _, ok := frame.Payload.(ChannelMessage); !ok {
+		t.Fatalf("the legacy payload is %#v, want the message without the channel", frame.Payload)
+	}
+
+	frame, _ = Event{Type: EventChannelDeleted, Payload: ChannelDeletedPayload{ChannelId: channel.Id}}.Legacy()
+	if frame.Payload != channel.Id.Hex() || frame.Code != "3" {
+		t.Fatalf("got the frame %+v, want the id of the channel", frame)
+	}
+	frame, _ = Event{Type: EventMemberAdded, Payload: MemberPayload{Channel: channel.Channel}}.Legacy()
+	if payload, ok := frame.Payload.(Channel); !ok || payload.Id != channel.Id {
+		t.Fatalf("the legacy payload is %#v, want the channel", frame.Payload)
+	}
+
+	// Events the first protocol did not have are not sent to its clients
+	for _, eventType := range []EventType{EventHello, EventChannelArchived, EventChannelRestored} {
+		if _, ok := (Event{Type: eventType}).Legacy(); ok {
+			t.Errorf("%s has a legacy frame", eventType)
+		}
+	}
+}
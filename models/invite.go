@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invite lets anyone with its code join the channel with Role, MaxUses zero
+// means no limit.
+type Invite struct {
+	Id        primitive.ObjectID `bson:"_id" json:"_id"`
+	Code      string             `bson:"code" json:"code"`
+	ChannelId primitive.ObjectID `bson:"channel_id" json:"channel_id"`
+	CreatedBy primitive.ObjectID `bson:"created_by" json:"created_by"`
+	Role      string             `bson:"role" json:"role"`
+	MaxUses   int                `bson:"max_uses" json:"max_uses"`
+	Uses      int                `bson:"uses" json:"uses"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Revoked   bool               `bson:"revoked" json:"revoked"`
+}
+
+// Usable reports if the invite can still be redeemed.
+func (invite *Invite) Usable(now time.Time) bool {
+	if invite.Revoked || (invite.ExpiresAt != nil && !now.Before(*invite.ExpiresAt)) {
+		return false
+	}
+	return invite.MaxUses == 0 || invite.Uses < invite.MaxUses
+}
@@ -0,0 +1,89 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type ChannelMessage struct {
+	Id          primitive.ObjectID   `bson:"_id" json:"_id"`
+	ChannelId   primitive.ObjectID   `bson:"channel_id" json:"channel_id"`
+	Parent      *primitive.ObjectID  `bson:"parent,omitempty" json:"parent,omitempty"`
+	User        Profile              `bson:"user" json:"user"`
+	Date        string               `bson:"date" json:"date"`
+	Description string               `bson:"description" json:"description"`
+	Image       string               `bson:"image" json:"image"`
+	DesertRef   string               `bson:"desert_ref" json:"desert_ref"`
+	EditedAt    string               `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	Deleted     bool                 `bson:"deleted" json:"deleted"`
+	ReplyCount  int                  `bson:"reply_count" json:"reply_count"`
+	LastReplyAt string               `bson:"last_reply_at,omitempty" json:"last_reply_at,omitempty"`
+	Reactions   []MessageReaction    `bson:"reactions,omitempty" json:"reactions"`
+	Mentions    []primitive.ObjectID `bson:"mentions,omitempty" json:"mentions,omitempty"`
+}
+
+// MessageReaction stores who reacted with an emoji, the users are never sent
+// to the clients, they only get the count and if they are part of it.
+type MessageReaction struct {
+	Emoji string               `bson:"emoji" json:"emoji"`
+	Users []primitive.ObjectID `bson:"users" json:"-"`
+	Count int                  `bson:"-" json:"count"`
+	Me    bool                 `bson:"-" json:"me"`
+}
+
+// ReactionDelta is the only data sent to the clients when a reaction changes.
+type ReactionDelta struct {
+	ChannelId primitive.ObjectID `json:"channel_id"`
+	MessageId primitive.ObjectID `json:"message_id"`
+	Emoji     string             `json:"emoji"`
+	UserId    primitive.ObjectID `json:"user_id"`
+	Added     bool               `json:"added"`
+	Count     int                `json:"count"`
+}
+
+// SummarizeReactions fills the counts of the reactions as seen by a user.
+func (message *ChannelMessage) SummarizeReactions(userId primitive.ObjectID) {
+	for i := range message.Reactions {
+		reaction := &message.Reactions[i]
+		reaction.Count = len(reaction.Users)
+		reaction.Me = false
+		for _, user := range reaction.Users {
+			if user == userId {
+				reaction.Me = true
+				break
+			}
+		}
+	}
+}
+
+// ReactionCount returns how many users reacted with an emoji.
+func (message *ChannelMessage) ReactionCount(emoji string) int {
+	for _, reaction := range message.Reactions {
+		if reaction.Emoji == emoji {
+			return len(reaction.Users)
+		}
+	}
+	return 0
+}
+
+type UpdateMessage struct {
+	Description string `bson:"description" json:"description"`
+	Image       string `bson:"image" json:"image"`
+	DesertRef   string `bson:"desert_ref" json:"desert_ref"`
+	EditedAt    string `bson:"edited_at" json:"edited_at"`
+}
+
+// ThreadReply is sent to the clients when a reply is posted, the parent carries
+// the updated reply count.
+type ThreadReply struct {
+	Reply  ChannelMessage `json:"reply"`
+	Parent ChannelMessage `json:"parent"`
+}
+
+// MessagePage selects a window of the history of a channel. Before and After
+// are exclusive message ids, the zero value means there is no bound. When
+// Parent is set the page is read from the replies of that message instead of
+// the top level messages.
+type MessagePage struct {
+	Parent primitive.ObjectID
+	Before primitive.ObjectID
+	After  primitive.ObjectID
+	Limit  int
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// OIDCLogin keeps what the callback of a single sign on login needs, it is
+// found by the hash of the state sent to the provider.
+type OIDCLogin struct {
+	StateHash string `bson:"_id" json:"-"`
+	Nonce     string `bson:"nonce" json:"-"`
+	Verifier  string `bson:"verifier" json:"-"`
+	// Device name asked for the session of the login
+	DeviceName string    `bson:"device_name" json:"-"`
+	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	PresenceOnline       = "online"
+	PresenceAway         = "away"
+	PresenceDoNotDisturb = "dnd"
+	PresenceOffline      = "offline"
+)
+
+type Presence struct {
+	UserId   primitive.ObjectID `json:"user_id"`
+	Status   string             `json:"status"`
+	LastSeen string             `json:"last_seen,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ReadState is how far a user has read a channel, LastRead is the id of the
+// newest message the user has seen.
+type ReadState struct {
+	UserId    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ChannelId primitive.ObjectID `bson:"channel_id" json:"channel_id"`
+	LastRead  primitive.ObjectID `bson:"last_read" json:"last_read"`
+	UpdatedAt string             `bson:"updated_at" json:"updated_at"`
+}
+
+// UnreadCount is the number of unread messages of a channel, and how many of
+// them mention the user.
+type UnreadCount struct {
+	Unread   int `bson:"unread"`
+	Mentions int `bson:"mentions"`
+}
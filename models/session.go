@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is created on every login and lives as long as its refresh token,
+// the access tokens carry its id so they die with it.
+type Session struct {
+	Id          primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	RefreshHash string             `bson:"refresh_hash" json:"-"`
+	// Device of the login, named by the client or guessed from the user agent
+	DeviceName   string    `bson:"device_name" json:"device_name"`
+	UserAgent    string    `bson:"user_agent" json:"user_agent"`
+	IP           string    `bson:"ip" json:"ip"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	LastActiveAt time.Time `bson:"last_active_at" json:"last_active_at"`
+	ExpiresAt    time.Time `bson:"expires_at" json:"expires_at"`
+	Revoked      bool      `bson:"revoked" json:"revoked"`
+}
+
+// Active reports if the session can still be used.
+func (session *Session) Active(now time.Time) bool {
+	return !session.Revoked && now.Before(session.ExpiresAt)
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purposes of the single use tokens sent to the users by mail.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+	TokenLoginChallenge    = "login_challenge"
+)
+
+// UserToken is a single use token, only its hash is stored.
+type UserToken struct {
+	Id      primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId  primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Purpose string             `bson:"purpose" json:"purpose"`
+	// Address the token was mailed to, it is only valid while the account
+	// keeps that email
+	Email     string    `bson:"email,omitempty" json:"email,omitempty"`
+	Hash      string    `bson:"hash" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+	Used      bool      `bson:"used" json:"used"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// TwoFactor is the TOTP configuration of a user, the secret is stored while
+// the enrolment is pending and Enabled is set once the user confirms a code.
+type TwoFactor struct {
+	Secret  string `bson:"secret" json:"-"`
+	Enabled bool   `bson:"enabled" json:"enabled"`
+	// Hashes of the unused recovery codes
+	RecoveryCodes []string `bson:"recovery_codes" json:"-"`
+	// Last time step accepted, a code can not be used twice
+	LastStep int64 `bson:"last_step" json:"-"`
+}
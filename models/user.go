@@ -9,6 +9,15 @@ type User struct {
 	Password  string             `bson:"password" json:"password"`
 	Image     string             `bson:"image" json:"image"`
 	DesertRef string             `bson:"desertref" json:"desertref"`
+	LastSeen  string             `bson:"last_seen,omitempty" json:"last_seen,omitempty"`
+	// Accounts created before the verification existed are verified
+	Unverified bool       `bson:"unverified,omitempty" json:"unverified,omitempty"`
+	TwoFactor  *TwoFactor `bson:"two_factor,omitempty" json:"-"`
+	// Bots are owned by a human and authenticate with api keys
+	Bot     bool                `bson:"bot,omitempty" json:"bot,omitempty"`
+	OwnerId *primitive.ObjectID `bson:"owner_id,omitempty" json:"owner_id,omitempty"`
+	// Issuer and subject of the single sign on account linked to the user
+	OIDCSubject string `bson:"oidc_subject,omitempty" json:"-"`
 }
 
 type Profile struct {
@@ -17,12 +26,27 @@ type Profile struct {
 	Email     string             `bson:"email" json:"email"`
 	Image     string             `bson:"image" json:"image"`
 	DesertRef string             `bson:"desertref" json:"desertref"`
+	// Kept in the copies so the messages of bots show who they are
+	Bot     bool                `bson:"bot,omitempty" json:"bot,omitempty"`
+	OwnerId *primitive.ObjectID `bson:"owner_id,omitempty" json:"owner_id,omitempty"`
+	// Not stored with the copies of the profile kept in the channels
+	Unverified       bool `bson:"-" json:"unverified,omitempty"`
+	TwoFactorEnabled bool `bson:"-" json:"two_factor_enabled,omitempty"`
 }
 
 type InsertUser struct {
-	Name     string             `bson:"name" json:"name"`
-	Email    string             `bson:"email" json:"email"`
-	Password string             `bson:"password" json:"password"`
+	Name        string              `bson:"name" json:"name"`
+	Email       string              `bson:"email" json:"email"`
+	Password    string              `bson:"password" json:"password"`
+	Unverified  bool                `bson:"unverified,omitempty" json:"unverified,omitempty"`
+	Bot         bool                `bson:"bot,omitempty" json:"bot,omitempty"`
+	OwnerId     *primitive.ObjectID `bson:"owner_id,omitempty" json:"owner_id,omitempty"`
+	OIDCSubject string              `bson:"oidc_subject,omitempty" json:"-"`
+}
+
+// TwoFactorEnabled reports if the login of the user needs a second step.
+func (user *User) TwoFactorEnabled() bool {
+	return user.TwoFactor != nil && user.TwoFactor.Enabled
 }
 
 type UpdateUser struct {
@@ -32,4 +56,3 @@ type UpdateUser struct {
 	Image     string `bson:"image" json:"image"`
 	DesertRef string `bson:"desertref" json:"desertref"`
 }
-
@@ -1,7 +1,17 @@
 package models
 
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// WebsocketMessage is the frame sent to the clients, Id is only set on the
+// answers to a frame sent by the client and repeats the id it used.
 type WebsocketMessage struct {
 	Code    string      `json:"code" bson:"code"`
+	Id      string      `json:"id,omitempty" bson:"id,omitempty"`
 	Payload interface{} `json:"payload" bson:"payload"`
 	User    string      `json:"user" bson:"user"`
 }
+
+type TypingEvent struct {
+	UserId primitive.ObjectID `json:"user_id"`
+	Typing bool               `json:"typing"`
+}
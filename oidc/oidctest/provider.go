@@ -0,0 +1,175 @@
+// Package oidctest is a minimal OpenID Connect provider to test the single
+// sign on without a real one, every login is approved.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dg/acordia/jwks"
+	"github.com/dg/acordia/oidc"
+	"github.com/golang-jwt/jwt"
+)
+
+// User is who logs in, the login_hint of the authorization request replaces
+// the email.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type grant struct {
+	clientId    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	user        User
+}
+
+type Provider struct {
+	// Base url the provider is served on, it must be set before serving
+	Issuer string
+	User   User
+	key    *rsa.PrivateKey
+	keyId  string
+	mutex  *sync.Mutex
+	codes  map[string]grant
+}
+
+func NewProvider(issuer string, user User) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	// A new kid for every key, clients refetch the keys after a restart
+	keyId := make([]byte, 8)
+	if _, err := rand.Read(keyId); err != nil {
+		return nil, err
+	}
+	return &Provider{
+		Issuer: issuer,
+		User:   user,
+		key:    key,
+		keyId:  hex.EncodeToString(keyId),
+		mutex:  &sync.Mutex{},
+		codes:  make(map[string]grant),
+	}, nil
+}
+
+func (provider *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("/authorize", provider.authorize)
+	mux.HandleFunc("/token", provider.token)
+	mux.HandleFunc("/jwks", provider.keys)
+	return mux
+}
+
+func (provider *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, oidc.Metadata{
+		Issuer:                provider.Issuer,
+		AuthorizationEndpoint: provider.Issuer + "/authorize",
+		TokenEndpoint:         provider.Issuer + "/token",
+		JWKSURI:               provider.Issuer + "/jwks",
+	})
+}
+
+func (provider *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+		return
+	}
+	user := provider.User
+	if hint := query.Get("login_hint"); hint != "" {
+		user.Email = hint
+		user.Subject = "sub-" + hint
+	}
+	code := randomString()
+	provider.mutex.Lock()
+	provider.codes[code] = grant{
+		clientId:    query.Get("client_id"),
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		user:        user,
+	}
+	provider.mutex.Unlock()
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (provider *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	provider.mutex.Lock()
+	grant, ok := provider.codes[r.PostForm.Get("code")]
+	delete(provider.codes, r.PostForm.Get("code"))
+	provider.mutex.Unlock()
+	if !ok || grant.redirectURI != r.PostForm.Get("redirect_uri") || grant.challenge != oidc.CodeChallenge(r.PostForm.Get("code_verifier")) {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            provider.Issuer,
+		"sub":            grant.user.Subject,
+		"aud":            grant.clientId,
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.user.Email,
+		"email_verified": grant.user.EmailVerified,
+		"name":           grant.user.Name,
+	})
+	token.Header["kid"] = provider.keyId
+	idToken, err := token.SignedString(provider.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (provider *Provider) keys(w http.ResponseWriter, r *http.Request) {
+	key, err := jwks.FromPublicKey(provider.keyId, "RS256", &provider.key.PublicKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, jwks.Set{Keys: []jwks.Key{key}})
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func randomString() string {
+	data := make([]byte, 24)
+	rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,265 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dg/acordia/jwks"
+	"github.com/golang-jwt/jwt"
+)
+
+// The keys of the issuer are fetched again at most this often when a token
+// is signed with an unknown key
+const keysRefreshInterval = time.Minute
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNotConfigured  = errors.New("single sign on is not configured")
+)
+
+type Config struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	// Callback of the server registered in the provider
+	RedirectURL string
+}
+
+// Metadata is the part of the discovery document the login needs.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to the OpenID Connect provider, its metadata and keys are
+// fetched on first use so the server starts even when it is down.
+type Provider struct {
+	config      Config
+	client      *http.Client
+	mutex       *sync.Mutex
+	metadata    *Metadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{
+		config: config,
+		client: client,
+		mutex:  &sync.Mutex{},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+// IDTokenClaims are the claims of the id token used to find the user.
+type IDTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       string   `json:"picture"`
+}
+
+func (claims *IDTokenClaims) Valid() error {
+	if time.Now().Unix() > claims.ExpiresAt {
+		return ErrInvalidIDToken
+	}
+	return nil
+}
+
+// audience is a string or a list of strings in the tokens.
+type audience []string
+
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*aud = list
+	return nil
+}
+
+func (aud audience) contains(value string) bool {
+	for _, current := range aud {
+		if current == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeChallenge is the S256 PKCE challenge of the verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where the user is sent to log in.
+func (provider *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.config.ClientId)
+	query.Set("redirect_uri", provider.config.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the code for the tokens and returns the verified claims of
+// the id token.
+func (provider *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (*IDTokenClaims, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", provider.config.ClientId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if provider.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(provider.config.ClientId), url.QueryEscape(provider.config.ClientSecret))
+	}
+	var tokens struct {
+		IdToken string `json:"id_token"`
+	}
+	if err := provider.do(req, &tokens); err != nil {
+		return nil, err
+	}
+	return provider.VerifyIDToken(ctx, tokens.IdToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiration and nonce
+// of the token.
+func (provider *Provider) VerifyIDToken(ctx context.Context, raw string, nonce string) (*IDTokenClaims, error) {
+	metadata, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, ErrInvalidIDToken
+		}
+		kid, _ := token.Header["kid"].(string)
+		return provider.key(ctx, metadata, kid)
+	})
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	if claims.Issuer != metadata.Issuer || !claims.Audience.contains(provider.config.ClientId) || claims.Nonce != nonce {
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+func (provider *Provider) discover(ctx context.Context) (*Metadata, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if provider.metadata != nil {
+		return provider.metadata, nil
+	}
+	endpoint := strings.TrimSuffix(provider.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	var metadata Metadata
+	if err := provider.do(req, &metadata); err != nil {
+		return nil, err
+	}
+	if metadata.Issuer != provider.config.Issuer {
+		return nil, fmt.Errorf("the provider issuer %q does not match %q", metadata.Issuer, provider.config.Issuer)
+	}
+	provider.metadata = &metadata
+	return provider.metadata, nil
+}
+
+// key returns the key with the id, the keys are fetched again when it is
+// unknown because the provider may have rotated them.
+func (provider *Provider) key(ctx context.Context, metadata *Metadata, kid string) (*rsa.PublicKey, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if key, ok := provider.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(provider.keysFetched) < keysRefreshInterval {
+		return nil, ErrInvalidIDToken
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jwks.Set
+	if err := provider.do(req, &set); err != nil {
+		return nil, err
+	}
+	provider.keysFetched = time.Now()
+	provider.keys = make(map[string]*rsa.PublicKey)
+	for _, current := range set.Keys {
+		public, err := current.PublicKey()
+		if err != nil {
+			continue
+		}
+		if rsaKey, ok := public.(*rsa.PublicKey); ok {
+			provider.keys[current.Kid] = rsaKey
+		}
+	}
+	if key, ok := provider.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+func (provider *Provider) do(req *http.Request, out interface{}) error {
+	res, err := provider.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", req.URL.Host, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,98 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/dg/acordia/oidc"
+	"github.com/dg/acordia/oidc/oidctest"
+)
+
+// newProvider serves the mock provider and returns a client of it.
+func newProvider(t *testing.T, clientId string) (*oidc.Provider, *oidctest.Provider) {
+	t.Helper()
+	idp, err := oidctest.NewProvider("", oidctest.User{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(idp.Handler())
+	t.Cleanup(server.Close)
+	idp.Issuer = server.URL
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      server.URL,
+		ClientId:    clientId,
+		RedirectURL: "http://localhost/oidc/callback",
+	}, nil)
+	return provider, idp
+}
+
+// authorize logs in on the provider and returns the code of the redirect.
+func authorize(t *testing.T, provider *oidc.Provider, nonce string, verifier string) string {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	redirect, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect.Query().Get("state") != "state" {
+		t.Fatalf("the provider answered the state %q", redirect.Query().Get("state"))
+	}
+	return redirect.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	provider, _ := newProvider(t, "acordia")
+	ctx := context.Background()
+
+	code := authorize(t, provider, "nonce", "verifier")
+	claims, err := provider.Exchange(ctx, code, "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.Name != "Alice" {
+		t.Fatalf("got the claims %+v", claims)
+	}
+	// Codes are used once
+	if _, err := provider.Exchange(ctx, code, "verifier", "nonce"); err == nil {
+		t.Fatal("a code was exchanged twice")
+	}
+
+	if _, err := provider.Exchange(ctx, authorize(t, provider, "nonce", "verifier"), "another-verifier", "nonce"); err == nil {
+		t.Fatal("the code was exchanged with the wrong verifier")
+	}
+	if _, err := provider.Exchange(ctx, authorize(t, provider, "nonce", "verifier"), "verifier", "another-nonce"); err != oidc.ErrInvalidIDToken {
+		t.Fatalf("got %v for the wrong nonce, want %v", err, oidc.ErrInvalidIDToken)
+	}
+}
+
+func TestExchangeChecksTheAudience(t *testing.T) {
+	provider, idp := newProvider(t, "acordia")
+	// The same provider issues the token to another client
+	other := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer, ClientId: "other", RedirectURL: "http://localhost/oidc/callback"}, nil)
+	code := authorize(t, other, "nonce", "verifier")
+	if _, err := provider.Exchange(context.Background(), code, "verifier", "nonce"); err != oidc.ErrInvalidIDToken {
+		t.Fatalf("got %v for the token of another client, want %v", err, oidc.ErrInvalidIDToken)
+	}
+}
+
+func TestDiscoveryChecksTheIssuer(t *testing.T) {
+	_, idp := newProvider(t, "acordia")
+	provider := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer + "/", ClientId: "acordia"}, nil)
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("the metadata of another issuer was accepted")
+	}
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ListBots(ctx context.Context, ownerId primitive.ObjectID) ([]models.Profile, error) {
+	return implementation.ListBots(ctx, ownerId)
+}
+
+func CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	return implementation.CreateAPIKey(ctx, key)
+}
+
+func GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	return implementation.GetAPIKeyByPrefix(ctx, prefix)
+}
+
+// ListAPIKeys returns the keys created by the user, for itself or its bots.
+func ListAPIKeys(ctx context.Context, createdBy primitive.ObjectID) ([]models.APIKey, error) {
+	return implementation.ListAPIKeys(ctx, createdBy)
+}
+
+// RevokeAPIKey fails when the key was not created by createdBy.
+func RevokeAPIKey(ctx context.Context, id string, createdBy primitive.ObjectID) error {
+	return implementation.RevokeAPIKey(ctx, id, createdBy)
+}
+
+// RevokeUserAPIKeys revokes the keys of the user and the ones it created.
+func RevokeUserAPIKeys(ctx context.Context, userId primitive.ObjectID) error {
+	return implementation.RevokeUserAPIKeys(ctx, userId)
+}
+
+func TouchAPIKey(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	return implementation.TouchAPIKey(ctx, id, now)
+}
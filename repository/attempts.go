@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+)
+
+// GetLoginAttempts returns an empty record when the key has no failures.
+func GetLoginAttempts(ctx context.Context, key string, now time.Time) (*models.LoginAttempts, error) {
+	return implementation.GetLoginAttempts(ctx, key, now)
+}
+
+// AddLoginFailure counts a failure for the key, the count is kept until
+// window passes without failures.
+func AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginAttempts, error) {
+	return implementation.AddLoginFailure(ctx, key, now, window)
+}
+
+func ClearLoginAttempts(ctx context.Context, key string) error {
+	return implementation.ClearLoginAttempts(ctx, key)
+}
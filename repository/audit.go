@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dg/acordia/models"
+)
+
+func AddAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	return implementation.AddAuditEntry(ctx, entry)
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/dg/acordia/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,6 +12,10 @@ func CreateChannel(ctx context.Context, data models.InsertChannel) (*models.Chan
 	return implementation.CreateChannel(ctx, data)
 }
 
+func GetChannelById(ctx context.Context, id string) (*models.Channel, error) {
+	return implementation.GetChannelById(ctx, id)
+}
+
 func UpdateChannel(ctx context.Context, id string, data models.UpdateChannel) (*models.Channel, error) {
 	return implementation.UpdateChannel(ctx, id, data)
 }
@@ -27,10 +32,49 @@ func RemoveUser(ctx context.Context, channelId string, userId string) (*models.C
 	return implementation.RemoveUser(ctx, channelId, userId)
 }
 
-func AddMessagesToChannel(ctx context.Context, data *models.ChannelMessage, channelId string) (*models.Channel, error) {
-	return implementation.AddMessagesToChannel(ctx, data, channelId)
+func SetChannelRole(ctx context.Context, channelId string, userId string, role string) (*models.Channel, error) {
+	return implementation.SetChannelRole(ctx, channelId, userId, role)
+}
+
+// TransferChannel makes the member the owner and the previous owner an admin
+// in a single write, it fails when the owner changed in between.
+func TransferChannel(ctx context.Context, channelId string, ownerId string, userId string) (*models.Channel, error) {
+	return implementation.TransferChannel(ctx, channelId, ownerId, userId)
 }
 
 func ListOfChannels(ctx context.Context, usOid primitive.ObjectID) ([]models.Channel, error) {
 	return implementation.ListOfChannels(ctx, usOid)
 }
+
+// OpenDirectChannel returns the channel with the direct key of data, it is
+// created from data when there is none. created reports which one happened.
+func OpenDirectChannel(ctx context.Context, data models.InsertChannel) (channel *models.Channel, created bool, err error) {
+	return implementation.OpenDirectChannel(ctx, data)
+}
+
+func ArchiveChannel(ctx context.Context, id string, now time.Time) (*models.Channel, error) {
+	return implementation.ArchiveChannel(ctx, id, now)
+}
+
+// TrashChannel soft deletes the channel, PurgeChannels removes it for good
+// after purgeAt.
+func TrashChannel(ctx context.Context, id string, now time.Time, purgeAt time.Time) (*models.Channel, error) {
+	return implementation.TrashChannel(ctx, id, now, purgeAt)
+}
+
+// RestoreChannel undoes both the archive and the soft delete.
+func RestoreChannel(ctx context.Context, id string) (*models.Channel, error) {
+	return implementation.RestoreChannel(ctx, id)
+}
+
+// PurgeChannels deletes the soft deleted channels due before now with their
+// history, it returns how many were purged.
+func PurgeChannels(ctx context.Context, now time.Time) (int, error) {
+	return implementation.PurgeChannels(ctx, now)
+}
+
+// DiscoverChannels searches the public channels by name, description and
+// tags.
+func DiscoverChannels(ctx context.Context, search models.ChannelSearch) ([]models.Channel, error) {
+	return implementation.DiscoverChannels(ctx, search)
+}
@@ -0,0 +1,9 @@
+package repository
+
+import "errors"
+
+var (
+	ErrNestedReply = errors.New("replies can not be answered, reply to the parent message instead")
+	// Bots have no email, every other account has its own
+	ErrDuplicateEmail = errors.New("the email is already used by another account")
+)
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+)
+
+func CreateInvite(ctx context.Context, invite *models.Invite) error {
+	return implementation.CreateInvite(ctx, invite)
+}
+
+func GetInviteByCode(ctx context.Context, code string) (*models.Invite, error) {
+	return implementation.GetInviteByCode(ctx, code)
+}
+
+// ListChannelInvites returns the invites of the channel, the newest first.
+func ListChannelInvites(ctx context.Context, channelId string) ([]models.Invite, error) {
+	return implementation.ListChannelInvites(ctx, channelId)
+}
+
+// RevokeInvite fails when the invite is not of the channel.
+func RevokeInvite(ctx context.Context, channelId string, id string) error {
+	return implementation.RevokeInvite(ctx, channelId, id)
+}
+
+// UseInvite counts a use of the invite only if it is still usable, so the
+// uses never go over the limit.
+func UseInvite(ctx context.Context, code string, now time.Time) (*models.Invite, error) {
+	return implementation.UseInvite(ctx, code, now)
+}
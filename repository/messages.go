@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func AddMessagesToChannel(ctx context.Context, data *models.ChannelMessage, channelId string) (*models.ChannelMessage, error) {
+	return implementation.AddMessagesToChannel(ctx, data, channelId)
+}
+
+func ListMessages(ctx context.Context, channelId string, page models.MessagePage) ([]models.ChannelMessage, error) {
+	return implementation.ListMessages(ctx, channelId, page)
+}
+
+func GetMessageById(ctx context.Context, channelId string, messageId string) (*models.ChannelMessage, error) {
+	return implementation.GetMessageById(ctx, channelId, messageId)
+}
+
+func UpdateMessage(ctx context.Context, channelId string, messageId string, data models.UpdateMessage) (*models.ChannelMessage, error) {
+	return implementation.UpdateMessage(ctx, channelId, messageId, data)
+}
+
+func DeleteMessage(ctx context.Context, channelId string, messageId string) (*models.ChannelMessage, error) {
+	return implementation.DeleteMessage(ctx, channelId, messageId)
+}
+
+func AddReaction(ctx context.Context, channelId string, messageId string, userId primitive.ObjectID, emoji string) (bool, error) {
+	return implementation.AddReaction(ctx, channelId, messageId, userId, emoji)
+}
+
+func RemoveReaction(ctx context.Context, channelId string, messageId string, userId primitive.ObjectID, emoji string) (bool, error) {
+	return implementation.RemoveReaction(ctx, channelId, messageId, userId, emoji)
+}
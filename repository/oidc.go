@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+)
+
+func CreateOIDCLogin(ctx context.Context, login *models.OIDCLogin) error {
+	return implementation.CreateOIDCLogin(ctx, login)
+}
+
+// UseOIDCLogin returns and removes the login, it fails when it expired.
+func UseOIDCLogin(ctx context.Context, stateHash string, now time.Time) (*models.OIDCLogin, error) {
+	return implementation.UseOIDCLogin(ctx, stateHash, now)
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MarkRead moves the read marker of the user up to the message, the boolean
+// is false when the user had already read a newer message.
+func MarkRead(ctx context.Context, channelId string, userId primitive.ObjectID, messageId string, date string) (*models.ReadState, bool, error) {
+	return implementation.MarkRead(ctx, channelId, userId, messageId, date)
+}
+
+func GetReadState(ctx context.Context, channelId string, userId primitive.ObjectID) (*models.ReadState, error) {
+	return implementation.GetReadState(ctx, channelId, userId)
+}
+
+func ListChannelReadStates(ctx context.Context, channelId string) ([]models.ReadState, error) {
+	return implementation.ListChannelReadStates(ctx, channelId)
+}
+
+// CountUnread returns the unread messages of the user in each channel, the
+// channels without unread messages are missing from the map.
+func CountUnread(ctx context.Context, channelIds []primitive.ObjectID, userId primitive.ObjectID) (map[primitive.ObjectID]models.UnreadCount, error) {
+	return implementation.CountUnread(ctx, channelIds, userId)
+}
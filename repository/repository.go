@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/dg/acordia/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,18 +13,92 @@ type Repository interface {
 	InsertUser(ctx context.Context, user *models.InsertUser) (*models.Profile, error)
 	GetUserById(ctx context.Context, id string) (*models.Profile, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserAccountById(ctx context.Context, id string) (*models.User, error)
 	ListUsers(ctx context.Context) ([]models.Profile, error)
 	UpdateUser(ctx context.Context, data models.UpdateUser) (*models.Profile, error)
 	DeleteUser(ctx context.Context, id string) error
+	SetLastSeen(ctx context.Context, userId primitive.ObjectID, date string) error
+	GetLastSeen(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error)
+	SetUserPassword(ctx context.Context, userId primitive.ObjectID, password string) error
+	SetUserVerified(ctx context.Context, userId primitive.ObjectID, verified bool) error
+	SetTwoFactor(ctx context.Context, userId primitive.ObjectID, twoFactor *models.TwoFactor) error
+	UseTwoFactorStep(ctx context.Context, userId primitive.ObjectID, step int64) error
+	UseRecoveryCode(ctx context.Context, userId primitive.ObjectID, hash string) error
+	GetUserByOIDCSubject(ctx context.Context, subject string) (*models.User, error)
+	SetUserOIDCSubject(ctx context.Context, userId primitive.ObjectID, subject string) error
 
 	//channels
 	CreateChannel(ctx context.Context, data models.InsertChannel) (*models.Channel, error)
+	GetChannelById(ctx context.Context, id string) (*models.Channel, error)
 	UpdateChannel(ctx context.Context, id string, data models.UpdateChannel) (*models.Channel, error)
 	DeleteChannel(ctx context.Context, id string) error
 	AddUserToChannel(ctx context.Context, userId string, channelId string) (*models.Channel, error)
 	RemoveUser(ctx context.Context, channelId string, userId string) (*models.Channel, error)
-	AddMessagesToChannel(ctx context.Context, data *models.ChannelMessage, channelId string) (*models.Channel, error)
+	SetChannelRole(ctx context.Context, channelId string, userId string, role string) (*models.Channel, error)
+	TransferChannel(ctx context.Context, channelId string, ownerId string, userId string) (*models.Channel, error)
 	ListOfChannels(ctx context.Context, usOid primitive.ObjectID) ([]models.Channel, error)
+	DiscoverChannels(ctx context.Context, search models.ChannelSearch) ([]models.Channel, error)
+	OpenDirectChannel(ctx context.Context, data models.InsertChannel) (*models.Channel, bool, error)
+	ArchiveChannel(ctx context.Context, id string, now time.Time) (*models.Channel, error)
+	TrashChannel(ctx context.Context, id string, now time.Time, purgeAt time.Time) (*models.Channel, error)
+	RestoreChannel(ctx context.Context, id string) (*models.Channel, error)
+	PurgeChannels(ctx context.Context, now time.Time) (int, error)
+
+	//messages
+	AddMessagesToChannel(ctx context.Context, data *models.ChannelMessage, channelId string) (*models.ChannelMessage, error)
+	ListMessages(ctx context.Context, channelId string, page models.MessagePage) ([]models.ChannelMessage, error)
+	GetMessageById(ctx context.Context, channelId string, messageId string) (*models.ChannelMessage, error)
+	UpdateMessage(ctx context.Context, channelId string, messageId string, data models.UpdateMessage) (*models.ChannelMessage, error)
+	DeleteMessage(ctx context.Context, channelId string, messageId string) (*models.ChannelMessage, error)
+	AddReaction(ctx context.Context, channelId string, messageId string, userId primitive.ObjectID, emoji string) (bool, error)
+	RemoveReaction(ctx context.Context, channelId string, messageId string, userId primitive.ObjectID, emoji string) (bool, error)
+
+	//read states
+	MarkRead(ctx context.Context, channelId string, userId primitive.ObjectID, messageId string, date string) (*models.ReadState, bool, error)
+	GetReadState(ctx context.Context, channelId string, userId primitive.ObjectID) (*models.ReadState, error)
+	ListChannelReadStates(ctx context.Context, channelId string) ([]models.ReadState, error)
+	CountUnread(ctx context.Context, channelIds []primitive.ObjectID, userId primitive.ObjectID) (map[primitive.ObjectID]models.UnreadCount, error)
+
+	//sessions
+	CreateSession(ctx context.Context, session *models.Session) (*models.Session, error)
+	GetSessionById(ctx context.Context, id string) (*models.Session, error)
+	RotateSession(ctx context.Context, id string, oldHash string, newHash string, expiresAt time.Time) error
+	ListUserSessions(ctx context.Context, userId primitive.ObjectID, now time.Time) ([]models.Session, error)
+	TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, userId primitive.ObjectID, keep primitive.ObjectID) error
+
+	//user tokens
+	CreateUserToken(ctx context.Context, token *models.UserToken) error
+	UseUserToken(ctx context.Context, purpose string, hash string, now time.Time) (*models.UserToken, error)
+	LatestUserToken(ctx context.Context, userId primitive.ObjectID, purpose string) (*models.UserToken, error)
+	ExpireUserTokens(ctx context.Context, userId primitive.ObjectID, purpose string) error
+
+	//single sign on
+	CreateOIDCLogin(ctx context.Context, login *models.OIDCLogin) error
+	UseOIDCLogin(ctx context.Context, stateHash string, now time.Time) (*models.OIDCLogin, error)
+
+	//login attempts
+	GetLoginAttempts(ctx context.Context, key string, now time.Time) (*models.LoginAttempts, error)
+	AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginAttempts, error)
+	ClearLoginAttempts(ctx context.Context, key string) error
+
+	//bots and api keys
+	ListBots(ctx context.Context, ownerId primitive.ObjectID) ([]models.Profile, error)
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, createdBy primitive.ObjectID) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string, createdBy primitive.ObjectID) error
+	RevokeUserAPIKeys(ctx context.Context, userId primitive.ObjectID) error
+	TouchAPIKey(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	CreateInvite(ctx context.Context, invite *models.Invite) error
+	GetInviteByCode(ctx context.Context, code string) (*models.Invite, error)
+	ListChannelInvites(ctx context.Context, channelId string) ([]models.Invite, error)
+	RevokeInvite(ctx context.Context, channelId string, id string) error
+	UseInvite(ctx context.Context, code string, now time.Time) (*models.Invite, error)
+
+	//audit log
+	AddAuditEntry(ctx context.Context, entry *models.AuditEntry) error
 
 	//Close the connection
 	Close() error
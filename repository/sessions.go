@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func CreateSession(ctx context.Context, session *models.Session) (*models.Session, error) {
+	return implementation.CreateSession(ctx, session)
+}
+
+func GetSessionById(ctx context.Context, id string) (*models.Session, error) {
+	return implementation.GetSessionById(ctx, id)
+}
+
+// RotateSession replaces the refresh token of an active session only if the
+// stored hash is still oldHash, so a refresh token can be used once.
+func RotateSession(ctx context.Context, id string, oldHash string, newHash string, expiresAt time.Time) error {
+	return implementation.RotateSession(ctx, id, oldHash, newHash, expiresAt)
+}
+
+// ListUserSessions returns the active sessions of the user, the most
+// recently used first.
+func ListUserSessions(ctx context.Context, userId primitive.ObjectID, now time.Time) ([]models.Session, error) {
+	return implementation.ListUserSessions(ctx, userId, now)
+}
+
+func TouchSession(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	return implementation.TouchSession(ctx, id, now)
+}
+
+func RevokeSession(ctx context.Context, id string) error {
+	return implementation.RevokeSession(ctx, id)
+}
+
+// RevokeUserSessions revokes every session of the user except keep, the zero
+// id revokes all of them.
+func RevokeUserSessions(ctx context.Context, userId primitive.ObjectID, keep primitive.ObjectID) error {
+	return implementation.RevokeUserSessions(ctx, userId, keep)
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func CreateUserToken(ctx context.Context, token *models.UserToken) error {
+	return implementation.CreateUserToken(ctx, token)
+}
+
+// UseUserToken consumes the token with the hash if it is still valid at now,
+// the other tokens of the user for the same purpose stop being valid too.
+func UseUserToken(ctx context.Context, purpose string, hash string, now time.Time) (*models.UserToken, error) {
+	return implementation.UseUserToken(ctx, purpose, hash, now)
+}
+
+func SetUserPassword(ctx context.Context, userId primitive.ObjectID, password string) error {
+	return implementation.SetUserPassword(ctx, userId, password)
+}
+
+// LatestUserToken returns the last token created for the user and purpose,
+// used or not.
+func LatestUserToken(ctx context.Context, userId primitive.ObjectID, purpose string) (*models.UserToken, error) {
+	return implementation.LatestUserToken(ctx, userId, purpose)
+}
+
+// ExpireUserTokens marks the pending tokens of the user for the purpose as
+// used.
+func ExpireUserTokens(ctx context.Context, userId primitive.ObjectID, purpose string) error {
+	return implementation.ExpireUserTokens(ctx, userId, purpose)
+}
+
+func SetUserVerified(ctx context.Context, userId primitive.ObjectID, verified bool) error {
+	return implementation.SetUserVerified(ctx, userId, verified)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func InsertUser(ctx context.Context, user *models.InsertUser) (*models.Profile, error) {
@@ -15,6 +16,12 @@ func GetUserById(ctx context.Context, id string) (*models.Profile, error) {
 func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	return implementation.GetUserByEmail(ctx, email)
 }
+
+// GetUserAccountById returns the whole user, with its password and two factor
+// configuration, GetUserById only returns the public profile.
+func GetUserAccountById(ctx context.Context, id string) (*models.User, error) {
+	return implementation.GetUserAccountById(ctx, id)
+}
 func ListUsers(ctx context.Context) ([]models.Profile, error) {
 	return implementation.ListUsers(ctx)
 }
@@ -24,3 +31,35 @@ func UpdateUser(ctx context.Context, data models.UpdateUser) (*models.Profile, e
 func DeleteUser(ctx context.Context, id string) error {
 	return implementation.DeleteUser(ctx, id)
 }
+func SetLastSeen(ctx context.Context, userId primitive.ObjectID, date string) error {
+	return implementation.SetLastSeen(ctx, userId, date)
+}
+func GetLastSeen(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	return implementation.GetLastSeen(ctx, ids)
+}
+
+// SetTwoFactor replaces the two factor configuration of the user, nil
+// disables it.
+func SetTwoFactor(ctx context.Context, userId primitive.ObjectID, twoFactor *models.TwoFactor) error {
+	return implementation.SetTwoFactor(ctx, userId, twoFactor)
+}
+
+// UseTwoFactorStep fails when a code of the same or a later time step was
+// already used.
+func UseTwoFactorStep(ctx context.Context, userId primitive.ObjectID, step int64) error {
+	return implementation.UseTwoFactorStep(ctx, userId, step)
+}
+
+// UseRecoveryCode removes the recovery code, it fails when the code is not
+// one of the user.
+func UseRecoveryCode(ctx context.Context, userId primitive.ObjectID, hash string) error {
+	return implementation.UseRecoveryCode(ctx, userId, hash)
+}
+
+func GetUserByOIDCSubject(ctx context.Context, subject string) (*models.User, error) {
+	return implementation.GetUserByOIDCSubject(ctx, subject)
+}
+
+func SetUserOIDCSubject(ctx context.Context, userId primitive.ObjectID, subject string) error {
+	return implementation.SetUserOIDCSubject(ctx, userId, subject)
+}
@@ -0,0 +1,38 @@
+package responses
+
+import (
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ChannelSummary struct {
+	models.Channel
+	Unread         int `json:"unread"`
+	UnreadMentions int `json:"unread_mentions"`
+	// Direct messages are shown with the name and image of the other user,
+	// group direct messages without a name with the names of the members
+	DisplayName  string           `json:"display_name"`
+	DisplayImage string           `json:"display_image"`
+	Peers        []models.Profile `json:"peers,omitempty"`
+}
+
+// ChannelListing is a public channel in the directory, it does not show the
+// members.
+type ChannelListing struct {
+	Id          primitive.ObjectID `json:"_id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Image       string             `json:"image"`
+	Color       string             `json:"color"`
+	Tags        []string           `json:"tags"`
+	MemberCount int                `json:"member_count"`
+	// The caller already joined
+	Member bool `json:"member"`
+}
+
+type ChannelDirectoryResponse struct {
+	Channels []ChannelListing `json:"channels"`
+	HasMore  bool             `json:"has_more"`
+	// Cursor of the next page
+	After string `json:"after,omitempty"`
+}
@@ -0,0 +1,13 @@
+package responses
+
+import "time"
+
+// InvitePreviewResponse is public, it only shows what is needed to decide to
+// join.
+type InvitePreviewResponse struct {
+	Code        string     `json:"code"`
+	Name        string     `json:"name"`
+	Image       string     `json:"image"`
+	MemberCount int        `json:"member_count"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,10 @@
+package responses
+
+import "github.com/dg/acordia/models"
+
+type MessagePageResponse struct {
+	Messages []models.ChannelMessage `json:"messages"`
+	Before   string                  `json:"before"`
+	After    string                  `json:"after"`
+	HasMore  bool                    `json:"has_more"`
+}
@@ -2,7 +2,10 @@ package responses
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type ErrorMessage struct {
@@ -32,6 +35,13 @@ func BadRequest(w http.ResponseWriter, message string) {
 	})
 }
 
+func Forbidden(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(ErrorMessage{
+		Message: message,
+	})
+}
+
 func NotFound(w http.ResponseWriter, message string) {
 	w.WriteHeader(http.StatusNotFound)
 	json.NewEncoder(w).Encode(ErrorMessage{
@@ -39,9 +49,34 @@ func NotFound(w http.ResponseWriter, message string) {
 	})
 }
 
+func Conflict(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(ErrorMessage{
+		Message: message,
+	})
+}
+
 func DeleteResponse(w http.ResponseWriter, message string) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(ErrorMessage{
 		Message: message,
 	})
 }
+
+func Accepted(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ErrorMessage{
+		Message: message,
+	})
+}
+
+// TooManyRequests tells the client how many seconds to wait with the
+// Retry-After header.
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(ErrorMessage{
+		Message: message,
+	})
+}
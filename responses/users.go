@@ -1,6 +1,40 @@
 package responses
 
+import "github.com/dg/acordia/models"
+
 type LoginResponse struct {
-	Message string `json:"message"`
-	Token   string `json:"token"`
+	Message      string `json:"message"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// TwoFactorChallengeResponse is the answer of the login of an account with
+// two factor enabled, the challenge is sent back with the code.
+type TwoFactorChallengeResponse struct {
+	Message   string `json:"message"`
+	Challenge string `json:"challenge"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse is the only time the recovery codes are shown.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// SessionResponse marks the session of the token used to list them.
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// APIKeyResponse is the only time the key is shown.
+type APIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
 }
@@ -5,29 +5,65 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/dg/acordia/auth"
 	database "github.com/dg/acordia/database"
+	"github.com/dg/acordia/mailer"
+	"github.com/dg/acordia/oidc"
 	repository "github.com/dg/acordia/repository"
 	"github.com/dg/acordia/websocket"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
 
+// DbURI values with this scheme keep all the data in memory, useful to run
+// the server and its handlers without a mongo cluster.
+const MemoryDbURI = "memory://"
+
+const (
+	// Deleted channels can be restored for this long unless the config
+	// sets another grace period
+	DefaultChannelDeleteGrace = 30 * 24 * time.Hour
+	// How often the deleted channels past their grace period are purged
+	channelPurgeInterval = 10 * time.Minute
+)
+
 type Config struct {
-	Port      string
+	Port string
+	// Signs and verifies HS256 tokens when there is no key directory, with
+	// one it only verifies them for auth.AccessTokenTTL after the start
 	JWTSecret string
-	DbURI     string
+	// Signing keys made with cmd/jwtkeys
+	JWTKeysDir string
+	DbURI      string
+	// Where the mails are sent, see mailer.New
+	MailerURI string
+	// Accounts that did not verify their email can not create channels or
+	// be added to them
+	RequireVerifiedEmail bool
+	// Single sign on is disabled when the issuer is empty
+	OIDC oidc.Config
+	// Deleted channels are purged after this, zero deletes them right away
+	ChannelDeleteGrace time.Duration
 }
 
 type Server interface {
 	Config() *Config
 	Hub() *websocket.Hub
+	Mailer() mailer.Mailer
+	OIDC() *oidc.Provider
+	Keys() *auth.KeySet
 }
 
 type Broker struct {
 	config *Config
 	router *mux.Router
 	hub    *websocket.Hub
+	mailer mailer.Mailer
+	oidc   *oidc.Provider
+	keys   *auth.KeySet
 }
 
 func (b *Broker) Config() *Config {
@@ -38,20 +74,49 @@ func (b *Broker) Hub() *websocket.Hub {
 	return b.hub
 }
 
+func (b *Broker) Mailer() mailer.Mailer {
+	return b.mailer
+}
+
+func (b *Broker) Keys() *auth.KeySet {
+	return b.keys
+}
+
+// OIDC returns nil when single sign on is not configured.
+func (b *Broker) OIDC() *oidc.Provider {
+	return b.oidc
+}
+
 func NewServer(ctx context.Context, config *Config) (*Broker, error) {
 	if config.Port == "" {
 		return nil, errors.New("port is required")
 	}
-	if config.JWTSecret == "" {
-		return nil, errors.New("jwt secret is required")
-	}
 	if config.DbURI == "" {
 		return nil, errors.New("database uri is required")
 	}
+	keys, err := auth.NewKeySet(config.JWTKeysDir, config.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+	if config.JWTKeysDir == "" {
+		log.Println("Signing tokens with the shared jwt secret, set a key directory to use asymmetric keys")
+	}
+	mail, err := mailer.New(config.MailerURI)
+	if err != nil {
+		return nil, err
+	}
 	broker := &Broker{
 		config: config,
 		router: mux.NewRouter(),
 		hub:    websocket.NewHub(),
+		mailer: mail,
+		keys:   keys,
+	}
+	if config.OIDC.Issuer != "" {
+		if config.OIDC.ClientId == "" || config.OIDC.RedirectURL == "" {
+			return nil, errors.New("oidc client id and redirect url are required")
+		}
+		broker.oidc = oidc.NewProvider(config.OIDC, nil)
 	}
 	return broker, nil
 }
@@ -62,20 +127,44 @@ func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedHeaders:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowCredentials: true,
 	})
 
 	handler := c.Handler(b.router)
-	repo, err := database.NewMongoRepo(b.config.DbURI)
+	repo, err := newRepository(b.config.DbURI)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	go b.Hub().Run()
+	go b.keys.Run()
 	repository.SetRepository(repo)
+	go purgeChannels()
 	log.Println("Server started on port", b.config.Port)
 	if err := http.ListenAndServe(b.config.Port, handler); err != nil {
 		log.Fatal("Server failed to start", err)
 	}
 }
+
+// purgeChannels removes the deleted channels past their grace period until
+// the program exits.
+func purgeChannels() {
+	for {
+		purged, err := repository.PurgeChannels(context.Background(), time.Now())
+		if err != nil {
+			log.Println("Error purging deleted channels:", err)
+		} else if purged > 0 {
+			log.Println("Purged", purged, "deleted channels")
+		}
+		time.Sleep(channelPurgeInterval)
+	}
+}
+
+func newRepository(uri string) (repository.Repository, error) {
+	if strings.HasPrefix(uri, MemoryDbURI) {
+		log.Println("Using in memory database, data will be lost on restart")
+		return database.NewMemoryRepo(), nil
+	}
+	return database.NewMongoRepo(uri)
+}
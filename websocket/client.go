@@ -1,6 +1,10 @@
 package websocket
 
 import (
+	"log"
+	"time"
+
+	"github.com/dg/acordia/models"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -25,16 +29,46 @@ type Broker struct {
 type Client struct {
 	hub      *Hub
 	id       string
+	session  string
 	channel  string
+	profile  *models.Profile
+	version  int
 	socket   *websocket.Conn
 	outbound chan []byte
+	// last typing frame accepted from this client, used for throttling
+	lastTyping time.Time
+	// set when the outbound buffer filled up and the socket was closed
+	closing bool
 }
 
 func NewClient(hub *Hub, socket *websocket.Conn) *Client {
 	return &Client{
 		hub:      hub,
 		socket:   socket,
-		outbound: make(chan []byte),
+		outbound: make(chan []byte, 256),
+	}
+}
+
+// send queues the frame matching the protocol of the client, the hub mutex
+// must be held.
+func (c *Client) send(current []byte, legacy []byte) {
+	data := current
+	if c.version < models.ProtocolVersion {
+		data = legacy
+	}
+	if data == nil {
+		return
+	}
+	select {
+	case c.outbound <- data:
+	default:
+		// Losing frames would leave the client out of date without knowing,
+		// closed it reconnects and catches up through the history
+		if !c.closing {
+			c.closing = true
+			log.Println("Closing a websocket client that can not keep up")
+			c.socket.Close()
+		}
 	}
 }
 
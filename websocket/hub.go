@@ -3,14 +3,14 @@ package websocket
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/dg/acordia/auth"
 	"github.com/dg/acordia/models"
 	"github.com/dg/acordia/repository"
-	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -20,6 +20,13 @@ var upgrader = websocket.Upgrader{
 		//Validate if the user is authorized to make requests, it's important to work with the token.
 		return true
 	},
+	// Preferred first, clients without a subprotocol use the legacy frames
+	Subprotocols: []string{"acordia.v2", "acordia.v1"},
+}
+
+var protocolVersions = map[string]int{
+	"acordia.v2": models.ProtocolVersion,
+	"acordia.v1": models.LegacyProtocolVersion,
 }
 
 type Hub struct {
@@ -27,6 +34,19 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	mutex      *sync.Mutex
+	typing     *typingTracker
+	presence   *presenceTracker
+	poster     MessagePoster
+}
+
+// inboundFrame is what the clients send through the socket, legacy clients
+// send a code instead of the type. The payload is decoded by the handler of
+// the event.
+type inboundFrame struct {
+	Type    models.EventType `json:"type"`
+	Code    string           `json:"code"`
+	Id      string           `json:"id"`
+	Payload json.RawMessage  `json:"payload"`
 }
 
 func NewHub() *Hub {
@@ -35,112 +55,252 @@ func NewHub() *Hub {
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		mutex:      &sync.Mutex{},
+		typing:     newTypingTracker(),
+		presence:   newPresenceTracker(),
 	}
 }
 
-func (hub *Hub) HandleWebSocket(JWTSecret string) http.HandlerFunc {
+func (hub *Hub) HandleWebSocket(keys *auth.KeySet) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		socket, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			http.Error(w, "Could not open websocket connection", http.StatusBadRequest)
-		}
-		client := NewClient(hub, socket)
-
 		// Get the value of the parameter sent in the URL
 		params := mux.Vars(r)
 		tokenString := strings.TrimSpace(params["Authorization"])
-		_, err = ValidateTokenAndGetProfile(JWTSecret, tokenString, r.Context())
+		profile, claims, err := ValidateTokenAndGetProfile(keys, tokenString, r.Context())
 		if err != nil {
 			http.Error(w, "Error validating token", http.StatusUnauthorized)
 			return
 		}
+		channel, err := repository.GetChannelById(r.Context(), BaseChannel(params["Channel"]))
+		if err != nil || channel.Deleted() || channel.RoleOf(profile.Id) == "" {
+			http.Error(w, "You are not a member of this channel", http.StatusForbidden)
+			return
+		}
+		socket, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader already answered the request
+			return
+		}
+		client := NewClient(hub, socket)
 		client.id = tokenString
+		client.session = claims.SessionId.Hex()
 		client.channel = params["Channel"]
+		client.profile = profile
+		client.version = models.LegacyProtocolVersion
+		if version, ok := protocolVersions[socket.Subprotocol()]; ok {
+			client.version = version
+		}
 
 		hub.register <- client
+		if client.version >= models.ProtocolVersion {
+			hub.sendTo(client, models.Event{Type: models.EventHello, Payload: helloPayload()})
+		}
 
 		go func() {
 			for {
-				_, _, err := client.socket.ReadMessage()
+				_, data, err := client.socket.ReadMessage()
 				if err != nil {
 					hub.unregister <- client
 					break
 				}
+				hub.handleFrame(client, data)
 			}
 		}()
 
 		go client.Write()
 	}
 }
+
+func helloPayload() models.HelloPayload {
+	return models.HelloPayload{
+		Version: models.ProtocolVersion,
+		Events:  sortedEvents(models.ServerEvents),
+	}
+}
+
+func (hub *Hub) handleFrame(client *Client, data []byte) {
+	var frame inboundFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return
+	}
+	if frame.Type == "" {
+		frame.Type = models.LegacyEventTypes[frame.Code]
+	}
+	switch frame.Type {
+	case models.EventTypingUpdate:
+		hub.handleTyping(client, frame.Payload)
+	case models.EventPostMessage:
+		hub.handlePostMessage(client, frame)
+	}
+}
+
 func (hub *Hub) Run() {
+	go hub.runPresence()
+	sweep := time.NewTicker(typingSweep)
+	defer sweep.Stop()
 	for {
 		select {
 		case client := <-hub.register:
 			hub.onConnect(client)
 		case client := <-hub.unregister:
 			hub.onDisconnect(client)
+		case now := <-sweep.C:
+			hub.expireTyping(now, nil)
 		}
 	}
 }
 
 func (hub *Hub) onConnect(client *Client) {
-	fmt.Println("Connecting")
-
 	hub.mutex.Lock()
-	defer hub.mutex.Unlock()
 	hub.clients = append(hub.clients, client)
+	hub.mutex.Unlock()
+
+	hub.connectPresence(client)
 }
 
 func (hub *Hub) onDisconnect(client *Client) {
-	fmt.Println("Disconnecting")
-
 	client.socket.Close()
 	hub.mutex.Lock()
-	defer hub.mutex.Unlock()
-
 	i := -1
 	for j, c := range hub.clients {
-		if c.id == client.id {
+		if c == client {
 			i = j
 		}
 	}
+	if i >= 0 {
+		copy(hub.clients[i:], hub.clients[i+1:])
+		hub.clients[len(hub.clients)-1] = nil
+		hub.clients = hub.clients[:len(hub.clients)-1]
+		close(client.outbound)
+	}
+	hub.mutex.Unlock()
 
-	copy(hub.clients[i:], hub.clients[i+1:])
-	hub.clients[len(hub.clients)-1] = nil
-	hub.clients = hub.clients[:len(hub.clients)-1]
+	hub.expireTyping(time.Now(), client)
+	if i >= 0 {
+		hub.disconnectPresence(client)
+	}
 }
 
-func (hub *Hub) Broadcast(message interface{}, channels []string) {
-	fmt.Println("send message")
-	fmt.Println(hub.clients)
+func (hub *Hub) Broadcast(event models.Event, channels []string) {
+	hub.broadcast(event, channels, nil)
+}
 
-	data, _ := json.Marshal(message)
+// broadcast sends the event to every client of the channels except the
+// sender, clients that can not keep up are closed instead of blocking the
+// hub.
+func (hub *Hub) broadcast(event models.Event, channels []string, sender *Client) {
+	current, legacy := encodeEvent(event)
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
 	for _, client := range hub.clients {
-		if ValidateChannel(client.channel, channels) {
-			client.outbound <- data
+		if client != sender && ValidateChannel(client.channel, channels) {
+			client.send(current, legacy)
 		}
 	}
 }
 
-func ValidateTokenAndGetProfile(JWTSecret string, tokenString string, ctx context.Context) (*models.Profile, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(JWTSecret), nil
-	})
-	if err != nil {
-		return nil, err
+// HasLegacyClients reports if a client of the channels uses the legacy
+// protocol, payloads only legacy frames carry are built just for them.
+func (hub *Hub) HasLegacyClients(channels []string) bool {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for _, client := range hub.clients {
+		if client.version < models.ProtocolVersion && ValidateChannel(client.channel, channels) {
+			return true
+		}
 	}
-	if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid {
-		userId := claims.UserId.Hex()
-		profile, err := repository.GetUserById(ctx, userId)
-		if err != nil {
-			return nil, err
+	return false
+}
+
+// Unsubscribe closes the sockets the user has open on the channel or its
+// threads, used when the user stops being a member.
+func (hub *Hub) Unsubscribe(channelId string, userId string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for _, client := range hub.clients {
+		if client.profile.Id.Hex() == userId && BaseChannel(client.channel) == channelId {
+			// The read loop of the client unregisters it
+			client.socket.Close()
+		}
+	}
+}
+
+// CloseSession closes the sockets opened with the tokens of a revoked session.
+func (hub *Hub) CloseSession(sessionId string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for _, client := range hub.clients {
+		if client.session == sessionId {
+			client.socket.Close()
+		}
+	}
+}
+
+// CloseUserSessions closes the sockets of every session of the user except
+// keep, the empty id closes all of them.
+func (hub *Hub) CloseUserSessions(userId string, keep string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for _, client := range hub.clients {
+		if client.profile.Id.Hex() == userId && client.session != keep {
+			client.socket.Close()
 		}
-		return profile, nil
-	} else {
-		return nil, err
 	}
 }
 
+func (hub *Hub) sendTo(client *Client, event models.Event) {
+	current, legacy := encodeEvent(event)
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	client.send(current, legacy)
+}
+
+// encodeEvent returns the frame for each protocol version, the legacy frame
+// is nil when the event did not exist in the legacy protocol.
+func encodeEvent(event models.Event) ([]byte, []byte) {
+	event.Version = models.ProtocolVersion
+	current, _ := json.Marshal(event)
+	var legacy []byte
+	if frame, ok := event.Legacy(); ok {
+		legacy, _ = json.Marshal(frame)
+	}
+	return current, legacy
+}
+
+func ValidateTokenAndGetProfile(keys *auth.KeySet, tokenString string, ctx context.Context) (*models.Profile, *models.AppClaims, error) {
+	claims, err := auth.ParseAccessToken(ctx, keys, tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+	userId := claims.UserId.Hex()
+	profile, err := repository.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return profile, claims, nil
+}
+
+// ThreadChannel is the name clients use to subscribe to the replies of a
+// message instead of the whole channel.
+func ThreadChannel(channelId string, messageId string) string {
+	return channelId + ":" + messageId
+}
+
+// BaseChannel returns the channel id of a websocket channel, removing the
+// message of thread channels.
+func BaseChannel(channel string) string {
+	return strings.SplitN(channel, ":", 2)[0]
+}
+
+// ThreadMessage returns the message of a thread channel, or an empty string
+// for the whole channel.
+func ThreadMessage(channel string) string {
+	parts := strings.SplitN(channel, ":", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
 func ValidateChannel(channel string, channels []string) bool {
 	for _, currchannel := range channels {
 		if currchannel == channel {
@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// connectedClient registers a client of the hub on the channel without
+// running the hub, the returned socket is the other end of the client.
+func connectedClient(t *testing.T, hub *Hub, channel string, version int) (*Client, *websocket.Conn) {
+	t.Helper()
+	sockets := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		socket, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		sockets <- socket
+	}))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := NewClient(hub, <-sockets)
+	client.channel = channel
+	client.profile = &models.Profile{Name: "alice"}
+	client.version = version
+	hub.clients = append(hub.clients, client)
+	return client, conn
+}
+
+func TestBroadcastClosesClientsThatCanNotKeepUp(t *testing.T) {
+	hub := NewHub()
+	slow, conn := connectedClient(t, hub, "general", models.ProtocolVersion)
+	other, _ := connectedClient(t, hub, "random", models.ProtocolVersion)
+
+	// Nothing writes the frames of the client, the buffer fills up
+	event := models.Event{Type: models.EventTyping, Payload: models.TypingPayload{}}
+	for i := 0; i <= cap(slow.outbound); i++ {
+		hub.Broadcast(event, []string{"general"})
+	}
+	if !slow.closing || other.closing {
+		t.Fatalf("closing is %v for the slow client and %v for the other one", slow.closing, other.closing)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("the socket of the slow client is still open")
+	}
+}
+
+// registeredClient is a client of the hub without a socket, the frames sent
+// to it stay in its outbound buffer.
+func registeredClient(hub *Hub, channel string, name string) *Client {
+	client := NewClient(hub, nil)
+	client.channel = channel
+	client.profile = &models.Profile{Id: primitive.NewObjectID(), Name: name}
+	client.version = models.ProtocolVersion
+	hub.clients = append(hub.clients, client)
+	return client
+}
+
+type sentFrame struct {
+	Type    models.EventType `json:"type"`
+	Payload json.RawMessage  `json:"payload"`
+}
+
+// sentFrames empties the outbound buffer of the client.
+func sentFrames(t *testing.T, client *Client) []sentFrame {
+	t.Helper()
+	var frames []sentFrame
+	for {
+		select {
+		case data := <-client.outbound:
+			var frame sentFrame
+			if err := json.Unmarshal(data, &frame); err != nil {
+				t.Fatal(err)
+			}
+			frames = append(frames, frame)
+		default:
+			return frames
+		}
+	}
+}
+
+func TestThreadChannel(t *testing.T) {
+	thread := ThreadChannel("general", "hello")
+	if BaseChannel(thread) != "general" || ThreadMessage(thread) != "hello" {
+		t.Fatalf("%q splits into %q and %q", thread, BaseChannel(thread), ThreadMessage(thread))
+	}
+	if BaseChannel("general") != "general" || ThreadMessage("general") != "" {
+		t.Fatal("a channel without a thread has a message")
+	}
+}
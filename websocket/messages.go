@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dg/acordia/models"
+)
+
+const postTimeout = 10 * time.Second
+
+// MessagePoster stores a message posted through the socket of a client, it
+// is set by the handlers so both paths store messages the same way. The
+// parent is empty unless the socket is on a thread, then the message is a
+// reply to it.
+type MessagePoster func(ctx context.Context, profile *models.Profile, channelId string, parentId string, payload models.PostMessagePayload) (*PostedMessage, error)
+
+// PostedMessage is the stored message and the event to send to the other
+// clients of the channels.
+type PostedMessage struct {
+	Message  models.ChannelMessage
+	Event    models.Event
+	Channels []string
+}
+
+func (hub *Hub) SetMessagePoster(poster MessagePoster) {
+	hub.poster = poster
+}
+
+// handlePostMessage answers the sender with an ack carrying the stored
+// message, or an error, and sends the message to everyone else.
+func (hub *Hub) handlePostMessage(client *Client, frame inboundFrame) {
+	var payload models.PostMessagePayload
+	if err := json.Unmarshal(frame.Payload, &payload); err != nil {
+		hub.sendError(client, frame.Id, "Invalid request")
+		return
+	}
+	if hub.poster == nil {
+		hub.sendError(client, frame.Id, "Posting messages is not available")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postTimeout)
+	defer cancel()
+	posted, err := hub.poster(ctx, client.profile, BaseChannel(client.channel), ThreadMessage(client.channel), payload)
+	if err != nil {
+		hub.sendError(client, frame.Id, err.Error())
+		return
+	}
+	hub.sendTo(client, models.Event{
+		Type:    models.EventAck,
+		Id:      frame.Id,
+		Payload: models.MessagePayload{Message: posted.Message},
+		User:    client.profile.Name,
+	})
+	hub.broadcast(posted.Event, posted.Channels, client)
+}
+
+func (hub *Hub) sendError(client *Client, id string, message string) {
+	hub.sendTo(client, models.Event{
+		Type:    models.EventError,
+		Id:      id,
+		Payload: models.ErrorPayload{Message: message},
+	})
+}
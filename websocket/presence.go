@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/dg/acordia/models"
+	"github.com/dg/acordia/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidStatus = errors.New("invalid presence status")
+
+type presenceState struct {
+	sockets int
+	// status chosen by the user, empty while it is derived from the sockets
+	status string
+}
+
+// The changes are queued while holding the mutex and published by a single
+// goroutine, so the clients see them in the order they happened.
+type presenceTracker struct {
+	mutex   *sync.Mutex
+	users   map[primitive.ObjectID]*presenceState
+	pending []models.Presence
+	wake    chan struct{}
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{
+		mutex: &sync.Mutex{},
+		users: make(map[primitive.ObjectID]*presenceState),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// queue must be called with the mutex held.
+func (tracker *presenceTracker) queue(presence models.Presence) {
+	tracker.pending = append(tracker.pending, presence)
+	select {
+	case tracker.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runPresence publishes the queued changes until the program exits.
+func (hub *Hub) runPresence() {
+	for range hub.presence.wake {
+		hub.presence.mutex.Lock()
+		pending := hub.presence.pending
+		hub.presence.pending = nil
+		hub.presence.mutex.Unlock()
+		for _, presence := range pending {
+			if presence.Status == models.PresenceOffline && presence.LastSeen != "" {
+				if err := repository.SetLastSeen(context.Background(), presence.UserId, presence.LastSeen); err != nil {
+					log.Println("Error saving last seen", err)
+				}
+			}
+			hub.publishPresence(presence)
+		}
+	}
+}
+
+// A user is online while any of its devices has a socket open, the explicit
+// status only applies on top of that.
+func (state *presenceState) current() string {
+	if state == nil || state.sockets == 0 {
+		return models.PresenceOffline
+	}
+	if state.status != "" {
+		return state.status
+	}
+	return models.PresenceOnline
+}
+
+func (hub *Hub) connectPresence(client *Client) {
+	hub.presence.mutex.Lock()
+	state, ok := hub.presence.users[client.profile.Id]
+	if !ok {
+		state = &presenceState{}
+		hub.presence.users[client.profile.Id] = state
+	}
+	before := state.current()
+	state.sockets++
+	after := state.current()
+	if before != after {
+		hub.presence.queue(models.Presence{UserId: client.profile.Id, Status: after})
+	}
+	hub.presence.mutex.Unlock()
+}
+
+func (hub *Hub) disconnectPresence(client *Client) {
+	// Only used if it was the last socket of the user
+	lastSeen, _ := models.CurrentDate()
+	hub.presence.mutex.Lock()
+	defer hub.presence.mutex.Unlock()
+	state, ok := hub.presence.users[client.profile.Id]
+	if !ok {
+		return
+	}
+	state.sockets--
+	if state.sockets > 0 {
+		return
+	}
+	if state.status == "" {
+		delete(hub.presence.users, client.profile.Id)
+	}
+	hub.presence.queue(models.Presence{UserId: client.profile.Id, Status: models.PresenceOffline, LastSeen: lastSeen})
+}
+
+// SetStatus changes the explicit status of a user, online goes back to the
+// status derived from the sockets.
+func (hub *Hub) SetStatus(userId primitive.ObjectID, status string) (*models.Presence, error) {
+	switch status {
+	case models.PresenceOnline:
+		status = ""
+	case models.PresenceAway, models.PresenceDoNotDisturb:
+	default:
+		return nil, ErrInvalidStatus
+	}
+	hub.presence.mutex.Lock()
+	state, ok := hub.presence.users[userId]
+	if !ok {
+		state = &presenceState{}
+		hub.presence.users[userId] = state
+	}
+	before := state.current()
+	state.status = status
+	after := state.current()
+	if state.sockets == 0 && status == "" {
+		delete(hub.presence.users, userId)
+	}
+	presence := models.Presence{UserId: userId, Status: after}
+	if before != after {
+		hub.presence.queue(presence)
+	}
+	hub.presence.mutex.Unlock()
+	return &presence, nil
+}
+
+func (hub *Hub) Presence(ctx context.Context, ids []primitive.ObjectID) ([]models.Presence, error) {
+	lastSeen, err := repository.GetLastSeen(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	hub.presence.mutex.Lock()
+	defer hub.presence.mutex.Unlock()
+	presences := []models.Presence{}
+	for _, id := range ids {
+		presence := models.Presence{UserId: id, Status: hub.presence.users[id].current()}
+		if presence.Status == models.PresenceOffline {
+			presence.LastSeen = lastSeen[id]
+		}
+		presences = append(presences, presence)
+	}
+	return presences, nil
+}
+
+// publishPresence sends the change to every channel of the user.
+func (hub *Hub) publishPresence(presence models.Presence) {
+	channels, err := repository.ListOfChannels(context.Background(), presence.UserId)
+	if err != nil {
+		log.Println("Error listing channels for presence", err)
+		return
+	}
+	ids := []string{}
+	for _, channel := range channels {
+		ids = append(ids, channel.Id.Hex())
+	}
+	event := models.Event{
+		Type:    models.EventPresenceChanged,
+		Payload: presence,
+	}
+	hub.Broadcast(event, ids)
+}
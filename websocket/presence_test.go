@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/dg/acordia/models"
+)
+
+func TestPresenceTransitions(t *testing.T) {
+	hub := NewHub()
+	phone, laptop := registeredClient(hub, "general", "alice"), registeredClient(hub, "random", "alice")
+	laptop.profile = phone.profile
+	userId := phone.profile.Id
+	expect := func(want ...string) {
+		t.Helper()
+		pending := hub.presence.pending
+		hub.presence.pending = nil
+		if len(pending) != len(want) {
+			t.Fatalf("queued %d changes, want %d", len(pending), len(want))
+		}
+		for i, presence := range pending {
+			if presence.UserId != userId || presence.Status != want[i] {
+				t.Fatalf("queued %+v, want %s", presence, want[i])
+			}
+		}
+	}
+
+	// The devices of a user share one presence
+	hub.connectPresence(phone)
+	hub.connectPresence(laptop)
+	expect(models.PresenceOnline)
+	if _, err := hub.SetStatus(userId, "sleeping"); err != ErrInvalidStatus {
+		t.Fatalf("got %v for an unknown status, want ErrInvalidStatus", err)
+	}
+	if _, err := hub.SetStatus(userId, models.PresenceAway); err != nil {
+		t.Fatal(err)
+	}
+	expect(models.PresenceAway)
+	hub.disconnectPresence(laptop)
+	expect()
+	hub.disconnectPresence(phone)
+	expect(models.PresenceOffline)
+
+	// The chosen status is kept for the next connection
+	hub.connectPresence(phone)
+	expect(models.PresenceAway)
+	presence, err := hub.SetStatus(userId, models.PresenceOnline)
+	if err != nil || presence.Status != models.PresenceOnline {
+		t.Fatalf("got %+v, %v going back online", presence, err)
+	}
+	expect(models.PresenceOnline)
+	hub.disconnectPresence(phone)
+	expect(models.PresenceOffline)
+	if len(hub.presence.users) != 0 {
+		t.Fatal("the tracker keeps the users without sockets or status")
+	}
+}
@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var objectIdType = reflect.TypeOf(primitive.ObjectID{})
+
+// schemaBuilder turns the payload structs into JSON schema definitions using
+// the same json tags the encoder uses, so the schema can not drift from the
+// frames that are actually sent.
+type schemaBuilder struct {
+	defs map[string]interface{}
+}
+
+func sortedEvents(events map[models.EventType]interface{}) []models.EventType {
+	types := []models.EventType{}
+	for eventType := range events {
+		types = append(types, eventType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// Schema describes every frame of the current protocol.
+func Schema() map[string]interface{} {
+	builder := &schemaBuilder{defs: make(map[string]interface{})}
+	serverEvents := map[string]interface{}{}
+	for _, eventType := range sortedEvents(models.ServerEvents) {
+		payload := builder.schemaOf(reflect.TypeOf(models.ServerEvents[eventType]))
+		serverEvents[string(eventType)] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":    map[string]interface{}{"const": eventType},
+				"version": map[string]interface{}{"const": models.ProtocolVersion},
+				"id":      map[string]interface{}{"type": "string"},
+				"user":    map[string]interface{}{"type": "string"},
+				"payload": payload,
+			},
+			"required": []string{"type", "version", "payload"},
+		}
+	}
+	clientEvents := map[string]interface{}{}
+	for _, eventType := range sortedEvents(models.ClientEvents) {
+		payload := builder.schemaOf(reflect.TypeOf(models.ClientEvents[eventType]))
+		clientEvents[string(eventType)] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":    map[string]interface{}{"const": eventType},
+				"id":      map[string]interface{}{"type": "string"},
+				"payload": payload,
+			},
+			"required": []string{"type", "payload"},
+		}
+	}
+	return map[string]interface{}{
+		"$schema":       "https://json-schema.org/draft/2020-12/schema",
+		"title":         "Acordia websocket protocol",
+		"version":       models.ProtocolVersion,
+		"subprotocol":   "acordia.v2",
+		"server_events": serverEvents,
+		"client_events": clientEvents,
+		"$defs":         builder.defs,
+	}
+}
+
+func (builder *schemaBuilder) schemaOf(t reflect.Type) map[string]interface{} {
+	if t == objectIdType {
+		return map[string]interface{}{"type": "string", "pattern": "^[0-9a-f]{24}$"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return map[string]interface{}{"anyOf": []interface{}{builder.schemaOf(t.Elem()), map[string]interface{}{"type": "null"}}}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": builder.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": builder.schemaOf(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := builder.defs[name]; !ok {
+			// Reserve the name first, structs can refer to themselves
+			builder.defs[name] = nil
+			properties := map[string]interface{}{}
+			required := []string{}
+			builder.addFields(t, properties, &required)
+			sort.Strings(required)
+			builder.defs[name] = map[string]interface{}{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			}
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (builder *schemaBuilder) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		// Embedded structs without a name are flattened by the encoder
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			builder.addFields(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = builder.schemaOf(field.Type)
+		omitempty := false
+		for _, option := range parts[1:] {
+			if option == "omitempty" {
+				omitempty = true
+			}
+		}
+		if !omitempty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func SchemaHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(Schema())
+	}
+}
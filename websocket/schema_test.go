@@ -0,0 +1,40 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/dg/acordia/models"
+)
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+	serverEvents := schema["server_events"].(map[string]interface{})
+	for eventType := range models.ServerEvents {
+		if _, ok := serverEvents[string(eventType)]; !ok {
+			t.Errorf("the schema misses the server event %s", eventType)
+		}
+	}
+	clientEvents := schema["client_events"].(map[string]interface{})
+	if len(clientEvents) != len(models.ClientEvents) {
+		t.Errorf("the schema has %d client events, want %d", len(clientEvents), len(models.ClientEvents))
+	}
+
+	defs := schema["$defs"].(map[string]interface{})
+	// Fields hidden from the encoder are not in the schema
+	payload := defs["MessagePayload"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := payload["message"]; !ok || len(payload) != 1 {
+		t.Fatalf("the message payload has the properties %v", payload)
+	}
+	message := defs["ChannelMessage"].(map[string]interface{})
+	required := map[string]bool{}
+	for _, name := range message["required"].([]string) {
+		required[name] = true
+	}
+	if !required["_id"] || required["parent"] || required["edited_at"] {
+		t.Fatalf("the message requires %v", message["required"])
+	}
+	id := message["properties"].(map[string]interface{})["_id"].(map[string]interface{})
+	if id["type"] != "string" || id["pattern"] == nil {
+		t.Fatalf("ids are described as %v", id)
+	}
+}
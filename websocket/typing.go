@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/dg/acordia/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// A user stops typing when no frame is received for this long
+	typingTimeout = 5 * time.Second
+	// Typing frames sent faster than this by the same client are dropped
+	typingThrottle = 500 * time.Millisecond
+	typingSweep    = time.Second
+)
+
+type typingKey struct {
+	channel string
+	user    primitive.ObjectID
+}
+
+type typingState struct {
+	client  *Client
+	expires time.Time
+}
+
+type typingTracker struct {
+	mutex  *sync.Mutex
+	states map[typingKey]*typingState
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{
+		mutex:  &sync.Mutex{},
+		states: make(map[typingKey]*typingState),
+	}
+}
+
+// handleTyping only sends the transitions to the other clients, frames that
+// keep a user typing just move the expiration.
+func (hub *Hub) handleTyping(client *Client, payload json.RawMessage) {
+	var frame models.TypingPayload
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		return
+	}
+	now := time.Now()
+	// Only the refreshes are throttled, a stop is always delivered
+	if frame.Typing {
+		if now.Sub(client.lastTyping) < typingThrottle {
+			return
+		}
+		client.lastTyping = now
+	}
+	key := typingKey{channel: client.channel, user: client.profile.Id}
+
+	hub.typing.mutex.Lock()
+	state, active := hub.typing.states[key]
+	if frame.Typing {
+		if active {
+			state.expires = now.Add(typingTimeout)
+		} else {
+			hub.typing.states[key] = &typingState{client: client, expires: now.Add(typingTimeout)}
+		}
+	} else if active {
+		delete(hub.typing.states, key)
+	}
+	hub.typing.mutex.Unlock()
+
+	if frame.Typing != active {
+		hub.sendTyping(client, frame.Typing)
+	}
+}
+
+func (hub *Hub) expireTyping(now time.Time, disconnected *Client) {
+	expired := []*Client{}
+	hub.typing.mutex.Lock()
+	for key, state := range hub.typing.states {
+		if state.client == disconnected || now.After(state.expires) {
+			expired = append(expired, state.client)
+			delete(hub.typing.states, key)
+		}
+	}
+	hub.typing.mutex.Unlock()
+	for _, client := range expired {
+		hub.sendTyping(client, false)
+	}
+}
+
+func (hub *Hub) sendTyping(client *Client, typing bool) {
+	event := models.Event{
+		Type:    models.EventTyping,
+		Payload: models.TypingEvent{UserId: client.profile.Id, Typing: typing},
+		User:    client.profile.Name,
+	}
+	hub.broadcast(event, []string{client.channel}, client)
+}
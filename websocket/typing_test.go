@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dg/acordia/models"
+)
+
+func TestTyping(t *testing.T) {
+	hub := NewHub()
+	alice, bob := registeredClient(hub, "general", "alice"), registeredClient(hub, "general", "bob")
+	other := registeredClient(hub, "random", "carol")
+	typing := func(value bool) {
+		payload, _ := json.Marshal(models.TypingPayload{Typing: value})
+		hub.handleTyping(alice, payload)
+	}
+	expect := func(want ...bool) {
+		t.Helper()
+		frames := sentFrames(t, bob)
+		if len(frames) != len(want) {
+			t.Fatalf("bob got %d typing frames, want %d", len(frames), len(want))
+		}
+		for i, frame := range frames {
+			var event models.TypingEvent
+			if err := json.Unmarshal(frame.Payload, &event); err != nil || frame.Type != models.EventTyping {
+				t.Fatalf("got the frame %s %s, %v", frame.Type, frame.Payload, err)
+			}
+			if event.UserId != alice.profile.Id || event.Typing != want[i] {
+				t.Fatalf("got the typing event %+v, want %v", event, want[i])
+			}
+		}
+	}
+
+	// Only the transitions are sent, and never to the typing client
+	typing(true)
+	expect(true)
+	alice.lastTyping = time.Time{}
+	typing(true)
+	expect()
+	// Stops are not throttled, starts are
+	typing(false)
+	expect(false)
+	typing(true)
+	expect()
+	if len(sentFrames(t, alice)) != 0 || len(sentFrames(t, other)) != 0 {
+		t.Fatal("the typing frames reached the sender or another channel")
+	}
+
+	alice.lastTyping = time.Time{}
+	typing(true)
+	expect(true)
+	hub.expireTyping(time.Now(), nil)
+	expect()
+	hub.expireTyping(time.Now().Add(typingTimeout+time.Second), nil)
+	expect(false)
+
+	// Closing the socket stops the typing
+	alice.lastTyping = time.Time{}
+	typing(true)
+	expect(true)
+	hub.expireTyping(time.Now(), alice)
+	expect(false)
+}